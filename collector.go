@@ -2,19 +2,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5"              // For Identifier, CopyFromRows
-	"github.com/jackc/pgx/v5/pgxpool"      // For the connection pool
+	"github.com/jackc/pgx/v5"         // For Identifier, CopyFromRows
+	"github.com/jackc/pgx/v5/pgxpool" // For the connection pool
+
+	"pumpfun/retry"
 )
 
 // --- Configuration ---
@@ -25,11 +38,54 @@ const (
 	pollInterval = 30 * time.Second // Adjust based on rate limits and needs
 
 	// DexScreener API (Consider using specific pairs endpoint if list is fixed)
-	dexScreenerAPIEndpoint = "https://api.dexscreener.com/latest/dex/search?q=SOL%20-meme%20-shitcoin"
+	// Base URL can be overridden with -dexscreener-url or DEXSCREENER_URL (e.g. a caching proxy)
+	defaultDexScreenerBaseURL = "https://api.dexscreener.com"
+	dexScreenerAPIPath        = "/latest/dex/search"
+	dexScreenerSearchQuery    = "SOL -meme -shitcoin" // Sent as ?q=; leave empty for endpoints that take none
 	// OR Use specific pairs endpoint (replace with actual addresses):
-	// dexScreenerAPIEndpoint = "https://api.dexscreener.com/latest/dex/pairs/solana/PAIR_ADDR1,PAIR_ADDR2,PAIR_ADDR3"
+	// dexScreenerAPIPath = "/latest/dex/pairs/solana/PAIR_ADDR1,PAIR_ADDR2,PAIR_ADDR3"
 
 	apiTimeout = 15 * time.Second // Timeout for API requests
+
+	// API base rotation: -dexscreener-url / DEXSCREENER_URL may list several comma-separated
+	// bases (official API plus mirrors/proxies). Each poll picks one by baseRotationStrategy:
+	// "round-robin" or "least-errored" (the base whose last error is oldest). A base that
+	// answers 429 is skipped for rateLimitCooldown unless every base is cooling down.
+	baseRotationStrategy = "round-robin"
+	rateLimitCooldown    = 2 * time.Minute
+
+	pollJitterPercent = 0.0 // Randomize each wait by ± this % of pollInterval so parallel bots don't poll in sync (0 = off)
+
+	defaultCollectChains = "solana" // Comma-separated DexScreener chain IDs to keep (override with -chains)
+
+	// TimescaleDB (-timescale): chunk size for the pair_snapshots hypertable
+	timescaleChunkInterval = "1 day"
+
+	// DB outage handling (see storeSnapshots)
+	dbDownAfterFailures = 3               // Consecutive failed inserts before switching to buffering
+	dbBufferMaxBatches  = 120             // Polls held in memory while the DB is down (~1h at 30s)
+	dbReconnectBackoff  = 5 * time.Second // First reconnect attempt delay, doubled per failure
+	dbReconnectMaxDelay = 5 * time.Minute // Cap on the reconnect delay
+	deadLetterDir       = "dead_letter"   // Batches that overflow the buffer are written here as JSON lines
+
+	// Streaming (-stream-url / STREAM_URL): DexScreener has no public push feed, so this reads
+	// any HTTP stream of DexScreener-shaped pair updates, one JSON document per line (NDJSON,
+	// or SSE "data:" lines), e.g. a relay bridging a websocket feed. Updates are batched
+	// (latest per pair) and inserted every streamFlushInterval or at streamMaxBatch pairs;
+	// polling continues for pairs the stream hasn't updated within pollInterval.
+	streamBufferSize     = 1000            // Updates queued between the reader and the batcher; a full queue stalls the reader
+	streamFlushInterval  = 2 * time.Second // Max time an update waits before insert
+	streamMaxBatch       = 500             // Distinct pairs that force an early flush
+	streamReconnectDelay = 1 * time.Second // First reconnect delay, doubled per failed connection
+	streamMaxReconnect   = 1 * time.Minute
+	streamMaxLineBytes   = 1 << 20
+
+	// build-profile defaults (see buildNormalizationProfile)
+	defaultProfileFile   = "normalization_profile.json"
+	defaultProfileWindow = 24 * time.Hour
+	// Profiles cover pairs quoted in this mint, as paperstrat trades them: the "SOL" symbol
+	// alone can be spoofed by any token
+	wrappedSOLMint = "So11111111111111111111111111111111111111112"
 )
 
 // --- Structs ---
@@ -37,6 +93,7 @@ const (
 // Simplified struct for database insertion
 type PairSnapshotData struct {
 	Timestamp         time.Time
+	ChainID           string
 	PairAddress       string
 	BaseTokenAddress  string
 	BaseTokenSymbol   string
@@ -57,7 +114,7 @@ type PairSnapshotData struct {
 	TxnsM5Sells       int
 	TxnsH1Buys        int
 	TxnsH1Sells       int
-	PairCreatedAt     time.Time
+	PairCreatedAt     *time.Time // nil (NULL) when DexScreener reports no creation time
 }
 
 // DexScreener structs (simplified, add more fields if needed)
@@ -65,17 +122,17 @@ type DexScreenerResponse struct {
 	Pairs []Pair `json:"pairs"`
 }
 type Pair struct {
-	ChainID       string      `json:"chainId"`
-	PairAddress   string      `json:"pairAddress"`
-	BaseToken     Token       `json:"baseToken"`
-	QuoteToken    Token       `json:"quoteToken"`
-	PriceNative   string      `json:"priceNative"`
-	PriceUsd      string      `json:"priceUsd"`
+	ChainID       string       `json:"chainId"`
+	PairAddress   string       `json:"pairAddress"`
+	BaseToken     Token        `json:"baseToken"`
+	QuoteToken    Token        `json:"quoteToken"`
+	PriceNative   flexString   `json:"priceNative"`
+	PriceUsd      flexString   `json:"priceUsd"`
 	Txns          Transactions `json:"txns"`
-	Volume        Volume      `json:"volume"`
-	PriceChange   PriceChange `json:"priceChange"`
-	Liquidity     Liquidity   `json:"liquidity"`
-	PairCreatedAt int64       `json:"pairCreatedAt"`
+	Volume        Volume       `json:"volume"`
+	PriceChange   PriceChange  `json:"priceChange"`
+	Liquidity     Liquidity    `json:"liquidity"`
+	PairCreatedAt flexInt      `json:"pairCreatedAt"`
 }
 type Token struct {
 	Address string `json:"address"`
@@ -86,29 +143,144 @@ type Transactions struct {
 	H1 BuysSells `json:"h1"`
 }
 type BuysSells struct {
-	Buys  int `json:"buys"`
-	Sells int `json:"sells"`
+	Buys  flexInt `json:"buys"`
+	Sells flexInt `json:"sells"`
 }
 type Volume struct {
-	M5  float64 `json:"m5"`
-	H1  float64 `json:"h1"`
-	H6  float64 `json:"h6"`
-	H24 float64 `json:"h24"`
+	M5  flexFloat `json:"m5"`
+	H1  flexFloat `json:"h1"`
+	H6  flexFloat `json:"h6"`
+	H24 flexFloat `json:"h24"`
 }
 type PriceChange struct {
-	M5  float64 `json:"m5"`
-	H1  float64 `json:"h1"`
-	H6  float64 `json:"h6"`
-	H24 float64 `json:"h24"`
+	M5  flexFloat `json:"m5"`
+	H1  flexFloat `json:"h1"`
+	H6  flexFloat `json:"h6"`
+	H24 flexFloat `json:"h24"`
 }
 type Liquidity struct {
-	Usd float64 `json:"usd"`
+	Usd flexFloat `json:"usd"`
+}
+
+// Lenient scalars: DexScreener sometimes sends null, a quoted string instead of a
+// number (or vice versa), or NaN/Inf. These never fail to decode; anything unusable
+// becomes the zero value (stored as 0 / empty rather than dropping the batch).
+type flexFloat float64
+type flexInt int64
+type flexString string
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	*f = flexFloat(decodeFlexNumber(data))
+	return nil
+}
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	v := decodeFlexNumber(data)
+	if v >= math.MaxInt64 || v <= math.MinInt64 {
+		v = 0 // Out of range can't be a real count or timestamp
+	}
+	*n = flexInt(v)
+	return nil
+}
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil {
+		*s = ""
+		return nil
+	}
+	switch x := v.(type) {
+	case string:
+		*s = flexString(x)
+	case float64:
+		*s = flexString(strconv.FormatFloat(x, 'f', -1, 64))
+	default:
+		*s = ""
+	}
+	return nil
+}
+
+func decodeFlexNumber(data []byte) float64 {
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil {
+		return 0
+	}
+	f := 0.0
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case string:
+		f, _ = strconv.ParseFloat(strings.TrimSpace(x), 64)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
+
+// Effective settings as printed by -print-config. The DSN's password is masked.
+type CollectorConfig struct {
+	DatabaseURL          string   `json:"databaseUrl"`
+	DexScreenerBaseURLs  []string `json:"dexScreenerBaseUrls"`
+	BaseRotationStrategy string   `json:"baseRotationStrategy"`
+	RateLimitCooldown    string   `json:"rateLimitCooldown"`
+	DexScreenerPath      string   `json:"dexScreenerPath"`
+	SearchQuery          string   `json:"searchQuery"`
+	Chains               []string `json:"chains"`
+	PollInterval         string   `json:"pollInterval"`
+	APITimeout           string   `json:"apiTimeout"`
+	StreamURL            string   `json:"streamUrl,omitempty"`
+	StreamFlushInterval  string   `json:"streamFlushInterval"`
+}
+
+// Connection health for the insert path. While down, polls are queued in buffer
+// (oldest first) and reconnects are attempted at nextAttempt.
+type dbHealth struct {
+	down                bool
+	consecutiveFailures int
+	buffer              [][]PairSnapshotData
+	reconnectAttempts   int // Failed reconnects this outage, drives dbReconnectPolicy
+	backoff             time.Duration
+	nextAttempt         time.Time
+	downSince           time.Time
 }
 
 // --- Global DB Pool ---
 var dbPool *pgxpool.Pool
+var dbState dbHealth
+
+// The DB calls behind storeSnapshots; tests swap in fakes to simulate an outage
+var insertBatch = insertSnapshotBatch
+var pingPool = func(ctx context.Context) error { return dbPool.Ping(ctx) }
+
+// Delay before each reconnect attempt while the DB is down; doubles per failure
+var dbReconnectPolicy = retry.Policy{BaseDelay: dbReconnectBackoff, MaxDelay: dbReconnectMaxDelay}
+
+var dexScreenerBaseURL = defaultDexScreenerBaseURL // Comma-separated; parsed into apiBases in main
+var apiBases *baseRotation
+var errRateLimited = errors.New("rate limited (429)")
+var collectChains = parseChainList(defaultCollectChains)
+var streamURL = os.Getenv("STREAM_URL") // Empty = polling only
+var streamReconnectPolicy = retry.Policy{BaseDelay: streamReconnectDelay, MaxDelay: streamMaxReconnect, Jitter: true}
 
 // --- Helper Functions ---
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// base ± up to jitterPercent of it, chosen uniformly, so instances started together
+// drift apart instead of polling on the same boundary. jitterPercent 0 returns base.
+func jitteredInterval(base time.Duration, jitterPercent float64) time.Duration {
+	if jitterPercent <= 0 {
+		return base
+	}
+	offset := (rand.Float64()*2 - 1) * jitterPercent / 100 * float64(base)
+	return base + time.Duration(offset)
+}
+
 func parseFloat(val string) float64 {
 	f, err := strconv.ParseFloat(val, 64)
 	if err != nil {
@@ -118,18 +290,64 @@ func parseFloat(val string) float64 {
 }
 
 // --- API Fetching ---
-func fetchDexScreenerData() ([]Pair, error) {
+
+// Builds a DexScreener URL from one configured base (-dexscreener-url / DEXSCREENER_URL).
+// The base may carry its own path prefix or query string (e.g. a caching proxy); both are kept.
+func dexScreenerURL(base, path string, params url.Values) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid DexScreener base URL %q", redactURL(base))
+	}
+	u = u.JoinPath(path)
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Polls the base chosen by apiBases and feeds the outcome back into its stats
+func fetchDexScreenerData(ctx context.Context) ([]Pair, error) {
+	base := apiBases.Pick(time.Now())
+	started := time.Now()
+	pairs, err := fetchFromBase(ctx, base.URL)
+	latency := time.Since(started)
+	apiBases.Record(base, latency, err, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", redactURL(base.URL), err)
+	}
+	log.Printf("🌐 Served by %s in %v", redactURL(base.URL), latency.Round(time.Millisecond))
+	return pairs, nil
+}
+
+func fetchFromBase(ctx context.Context, base string) ([]Pair, error) {
+	params := url.Values{}
+	if dexScreenerSearchQuery != "" {
+		params.Set("q", dexScreenerSearchQuery)
+	}
+	reqURL, err := dexScreenerURL(base, dexScreenerAPIPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
 	client := http.Client{Timeout: apiTimeout}
-	resp, err := client.Get(dexScreenerAPIEndpoint)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP GET error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusTooManyRequests {
-		log.Println("⚠️ WARN: Hit Rate Limit (HTTP 429). Consider increasing poll interval.")
-		// Optionally: return specific error or sleep before retry
-		return nil, fmt.Errorf("rate limited (429)")
+		log.Println("⚠️ WARN: Hit Rate Limit (HTTP 429). Consider increasing poll interval or adding mirrors.")
+		return nil, errRateLimited
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -146,30 +364,321 @@ func fetchDexScreenerData() ([]Pair, error) {
 		return []Pair{}, nil
 	}
 
-	var apiResponse DexScreenerResponse
-	if err := json.Unmarshal(bodyBytes, &apiResponse); err != nil {
-		return nil, fmt.Errorf("error decoding DexScreener JSON: %w. Body segment: %s", err, string(bodyBytes[:min(len(bodyBytes), 200)]))
+	rawPairs, err := rawDexScreenerPairs(bodyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w. Body segment: %s", err, string(bodyBytes[:min(len(bodyBytes), 200)]))
 	}
-	if apiResponse.Pairs == nil {
-		log.Println("ℹ️ API response had null 'pairs' array.")
+	if len(rawPairs) == 0 {
+		log.Println("ℹ️ API response had no pairs.")
 		return []Pair{}, nil
 	}
 
-	// Filter only Solana pairs client-side if using a broad search endpoint
-	solanaPairs := []Pair{}
-	if strings.Contains(dexScreenerAPIEndpoint, "/search") {
-		for _, p := range apiResponse.Pairs {
-			if p.ChainID == "solana" {
-				solanaPairs = append(solanaPairs, p)
+	// Decode pair by pair so one malformed entry doesn't drop the whole batch
+	pairs := make([]Pair, 0, len(rawPairs))
+	for _, rawPair := range rawPairs {
+		var p Pair
+		if err := json.Unmarshal(rawPair, &p); err != nil {
+			log.Printf("⚠️ Skipping malformed pair: %s", string(rawPair[:min(len(rawPair), 200)]))
+			continue
+		}
+		pairs = append(pairs, p)
+	}
+
+	// Search results are mixed-chain; keep only the chains we collect
+	return filterByChain(pairs, collectChains), nil
+}
+
+// --- API Base Rotation ---
+
+// Per-base request stats; a base is skipped while CooldownUntil is in the future
+type apiBase struct {
+	URL           string
+	Requests      int
+	Errors        int
+	RateLimits    int
+	TotalLatency  time.Duration // Successful requests only
+	LastError     time.Time
+	CooldownUntil time.Time
+}
+
+type baseRotation struct {
+	bases    []*apiBase
+	strategy string
+	next     int // Round-robin cursor
+}
+
+// Parses a comma-separated base list, validating each entry
+func newBaseRotation(list, strategy string) (*baseRotation, error) {
+	if strategy != "round-robin" && strategy != "least-errored" {
+		return nil, fmt.Errorf("unknown baseRotationStrategy %q (want round-robin or least-errored)", strategy)
+	}
+	r := &baseRotation{strategy: strategy}
+	for _, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if _, err := dexScreenerURL(raw, dexScreenerAPIPath, nil); err != nil {
+			return nil, err
+		}
+		r.bases = append(r.bases, &apiBase{URL: raw})
+	}
+	if len(r.bases) == 0 {
+		return nil, fmt.Errorf("no DexScreener base URL configured")
+	}
+	return r, nil
+}
+
+// Base for the next poll. Bases cooling down after a 429 are passed over; if all of
+// them are, the one whose cooldown ends first is used rather than skipping the poll.
+func (r *baseRotation) Pick(now time.Time) *apiBase {
+	var candidates []int
+	for i, b := range r.bases {
+		if !now.Before(b.CooldownUntil) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		soonest := 0
+		for i, b := range r.bases {
+			if b.CooldownUntil.Before(r.bases[soonest].CooldownUntil) {
+				soonest = i
+			}
+		}
+		return r.bases[soonest]
+	}
+
+	// Candidates in rotation order starting at the cursor
+	sort.Slice(candidates, func(a, b int) bool {
+		return (candidates[a]-r.next+len(r.bases))%len(r.bases) < (candidates[b]-r.next+len(r.bases))%len(r.bases)
+	})
+	chosen := candidates[0]
+	if r.strategy == "least-errored" {
+		for _, i := range candidates[1:] {
+			if r.bases[i].LastError.Before(r.bases[chosen].LastError) {
+				chosen = i
 			}
 		}
-		return solanaPairs, nil
 	}
+	r.next = (chosen + 1) % len(r.bases)
+	return r.bases[chosen]
+}
+
+// Updates b's stats with one request's outcome; a 429 starts its cooldown
+func (r *baseRotation) Record(b *apiBase, latency time.Duration, err error, now time.Time) {
+	b.Requests++
+	if err == nil {
+		b.TotalLatency += latency
+		return
+	}
+	b.Errors++
+	b.LastError = now
+	if errors.Is(err, errRateLimited) {
+		b.RateLimits++
+		b.CooldownUntil = now.Add(rateLimitCooldown)
+		if len(r.bases) > 1 {
+			log.Printf("⏸️ %s rate limited; preferring other bases until %s", redactURL(b.URL), b.CooldownUntil.Format(time.TimeOnly))
+		}
+	}
+}
+
+func (r *baseRotation) LogStats() {
+	for _, b := range r.bases {
+		avg := time.Duration(0)
+		if ok := b.Requests - b.Errors; ok > 0 {
+			avg = b.TotalLatency / time.Duration(ok)
+		}
+		log.Printf("📊 %s: %d requests, %d errors (%d rate limited), avg latency %v",
+			redactURL(b.URL), b.Requests, b.Errors, b.RateLimits, avg.Round(time.Millisecond))
+	}
+}
+
+// DexScreener answers in three shapes: {"pairs": [...]} (search, multi-pair lookups),
+// {"pair": {...}} (pair by address) and a bare [...] (token pairs). Returns the raw pair
+// objects from any of them; a missing or null pairs list is an empty result, not an error.
+func rawDexScreenerPairs(body []byte) ([]json.RawMessage, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("error decoding DexScreener pair array: %w", err)
+		}
+		return list, nil
+	}
+
+	var envelope struct {
+		Pairs []json.RawMessage `json:"pairs"`
+		Pair  json.RawMessage   `json:"pair"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("error decoding DexScreener JSON: %w", err)
+	}
+	if len(envelope.Pairs) > 0 {
+		return envelope.Pairs, nil
+	}
+	if len(envelope.Pair) > 0 && string(envelope.Pair) != "null" {
+		return []json.RawMessage{envelope.Pair}, nil
+	}
+	return nil, nil
+}
+
+func filterByChain(pairs []Pair, chains map[string]bool) []Pair {
+	kept := []Pair{}
+	for _, p := range pairs {
+		if chains[p.ChainID] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// Snapshot of the settings in effect after flag parsing, with credentials masked
+func resolveCollectorConfig() CollectorConfig {
+	bases := make([]string, 0, len(apiBases.bases))
+	for _, b := range apiBases.bases {
+		bases = append(bases, redactURL(b.URL))
+	}
+	chains := make([]string, 0, len(collectChains))
+	for c := range collectChains {
+		chains = append(chains, c)
+	}
+	sort.Strings(chains) // Stable output
+
+	cfg := CollectorConfig{
+		DatabaseURL:          redactURL(dbConnectionString),
+		DexScreenerBaseURLs:  bases,
+		BaseRotationStrategy: baseRotationStrategy,
+		RateLimitCooldown:    rateLimitCooldown.String(),
+		DexScreenerPath:      dexScreenerAPIPath,
+		SearchQuery:          dexScreenerSearchQuery,
+		Chains:               chains,
+		PollInterval:         pollInterval.String(),
+		APITimeout:           apiTimeout.String(),
+		StreamFlushInterval:  streamFlushInterval.String(),
+	}
+	if streamURL != "" {
+		cfg.StreamURL = redactURL(streamURL)
+	}
+	return cfg
+}
+
+// Masks the password in a URL's userinfo (and the whole value if it doesn't parse)
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[REDACTED]"
+	}
+	return u.Redacted()
+}
 
-	return apiResponse.Pairs, nil
+func parseChainList(list string) map[string]bool {
+	chains := make(map[string]bool)
+	for _, c := range strings.Split(list, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			chains[c] = true
+		}
+	}
+	return chains
 }
 
 // --- Database Operations ---
+
+// Mirrors schema.sql; every statement is idempotent so this runs on each start
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS pair_snapshots (
+		timestamp TIMESTAMPTZ NOT NULL,
+		chain_id TEXT NOT NULL,
+		pair_address TEXT NOT NULL,
+		base_token_address TEXT NOT NULL,
+		base_token_symbol TEXT,
+		quote_token_address TEXT NOT NULL,
+		quote_token_symbol TEXT,
+		price_native NUMERIC,
+		price_usd NUMERIC,
+		liquidity_usd NUMERIC,
+		volume_m5 NUMERIC,
+		volume_h1 NUMERIC,
+		volume_h6 NUMERIC,
+		volume_h24 NUMERIC,
+		price_change_m5 REAL,
+		price_change_h1 REAL,
+		price_change_h6 REAL,
+		price_change_h24 REAL,
+		txns_m5_buys INTEGER,
+		txns_m5_sells INTEGER,
+		txns_h1_buys INTEGER,
+		txns_h1_sells INTEGER,
+		pair_created_at TIMESTAMPTZ,
+		PRIMARY KEY (timestamp, chain_id, pair_address)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_pair_snapshots_timestamp ON pair_snapshots (timestamp DESC)`,
+	`CREATE INDEX IF NOT EXISTS idx_pair_snapshots_pair_timestamp ON pair_snapshots (pair_address, timestamp DESC)`,
+	`CREATE INDEX IF NOT EXISTS idx_pair_snapshots_chain_pair_timestamp ON pair_snapshots (chain_id, pair_address, timestamp DESC)`,
+}
+
+// The subset of pgxpool.Pool that extension detection needs, so it can be stubbed
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Whether the timescaledb extension is installed in the connected database (not just
+// available on the server: CREATE EXTENSION is left to the DBA)
+func timescaleInstalled(ctx context.Context, db rowQuerier) (bool, error) {
+	var installed bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&installed)
+	if err != nil {
+		return false, fmt.Errorf("checking for timescaledb extension: %w", err)
+	}
+	return installed, nil
+}
+
+// Creates pair_snapshots and its indexes if missing. With useTimescale, the table is
+// also converted to a hypertable on timestamp when the extension is installed; otherwise
+// it stays a regular table. Either way the insert path is the same.
+func ensureSchema(ctx context.Context, useTimescale bool) error {
+	for _, stmt := range schemaStatements {
+		if _, err := dbPool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("ensuring schema: %w", err)
+		}
+	}
+
+	if !useTimescale {
+		log.Println("🗄️ Storage mode: regular Postgres table")
+		return nil
+	}
+
+	installed, err := timescaleInstalled(ctx, dbPool)
+	if err != nil {
+		return err
+	}
+	if !installed {
+		log.Println("⚠️ -timescale set but the timescaledb extension isn't installed; using a regular Postgres table")
+		return nil
+	}
+
+	// if_not_exists makes this a no-op on later starts; migrate_data converts a table
+	// that already holds rows (this locks it while the rows are moved into chunks)
+	_, err = dbPool.Exec(ctx,
+		`SELECT create_hypertable('pair_snapshots', 'timestamp',
+			chunk_time_interval => $1::interval, if_not_exists => TRUE, migrate_data => TRUE)`,
+		timescaleChunkInterval)
+	if err != nil {
+		return fmt.Errorf("creating hypertable: %w", err)
+	}
+	log.Printf("🗄️ Storage mode: TimescaleDB hypertable (chunk interval %s)", timescaleChunkInterval)
+	return nil
+}
+
+// DexScreener's pairCreatedAt (ms) as a time, or nil when it's missing or zero so the
+// column stays NULL instead of recording 1970 (which would read as a 50-year-old pair)
+func pairCreatedTime(ms flexInt) *time.Time {
+	if ms <= 0 {
+		return nil
+	}
+	t := time.UnixMilli(int64(ms))
+	return &t
+}
+
 func insertSnapshotBatch(ctx context.Context, snapshots []PairSnapshotData) error {
 	if len(snapshots) == 0 {
 		return nil
@@ -179,7 +688,7 @@ func insertSnapshotBatch(ctx context.Context, snapshots []PairSnapshotData) erro
 	rows := make([][]interface{}, len(snapshots))
 	for i, s := range snapshots {
 		rows[i] = []interface{}{
-			s.Timestamp, s.PairAddress,
+			s.Timestamp, s.ChainID, s.PairAddress,
 			s.BaseTokenAddress, s.BaseTokenSymbol, s.QuoteTokenAddress, s.QuoteTokenSymbol,
 			s.PriceNative, s.PriceUsd, s.LiquidityUsd,
 			s.VolumeM5, s.VolumeH1, s.VolumeH6, s.VolumeH24,
@@ -191,7 +700,7 @@ func insertSnapshotBatch(ctx context.Context, snapshots []PairSnapshotData) erro
 
 	// Define columns in the order they appear in your rows slice
 	columnNames := []string{
-		"timestamp", "pair_address",
+		"timestamp", "chain_id", "pair_address",
 		"base_token_address", "base_token_symbol", "quote_token_address", "quote_token_symbol",
 		"price_native", "price_usd", "liquidity_usd",
 		"volume_m5", "volume_h1", "volume_h6", "volume_h24",
@@ -219,18 +728,254 @@ func insertSnapshotBatch(ctx context.Context, snapshots []PairSnapshotData) erro
 	return nil
 }
 
+// --- Normalization Profile ---
+
+// Baseline distribution of the scoring metrics, written by `collector build-profile`
+// and read by paperstrat to seed normalization before it has live history.
+//
+//	{
+//	  "generatedAt": "2025-04-01T12:00:00Z",
+//	  "window": "24h0m0s",          // how far back the snapshots go
+//	  "samples": 123456,            // snapshot rows the percentiles were computed from
+//	  "metrics": {                  // p05/p50/p95 of each metric
+//	    "priceChangeM5":  {"p05": -3.1, "p50": 0.2, "p95": 6.8},
+//	    "priceChangeH1":  {...},
+//	    "volumeM5":       {...},   // USD
+//	    "buySellRatioM5": {...},   // buys / (buys + sells), 0.5 when no txns
+//	    "liquidityUsd":   {...}
+//	  }
+//	}
+//
+// Only SOL-quoted Solana pairs are included, matching what paperstrat scores.
+type NormalizationProfile struct {
+	GeneratedAt time.Time                    `json:"generatedAt"`
+	Window      string                       `json:"window"`
+	Samples     int64                        `json:"samples"`
+	Metrics     map[string]MetricPercentiles `json:"metrics"`
+}
+
+type MetricPercentiles struct {
+	P05 float64 `json:"p05"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+}
+
+// Metric name -> SQL expression over pair_snapshots
+var profileMetrics = map[string]string{
+	"priceChangeM5":  "price_change_m5",
+	"priceChangeH1":  "price_change_h1",
+	"volumeM5":       "volume_m5",
+	"buySellRatioM5": "CASE WHEN txns_m5_buys + txns_m5_sells = 0 THEN 0.5 ELSE txns_m5_buys::float8 / (txns_m5_buys + txns_m5_sells) END",
+	"liquidityUsd":   "liquidity_usd",
+}
+
+func buildNormalizationProfile(ctx context.Context, window time.Duration) (NormalizationProfile, error) {
+	profile := NormalizationProfile{
+		GeneratedAt: time.Now().UTC(),
+		Window:      window.String(),
+		Metrics:     make(map[string]MetricPercentiles),
+	}
+	since := time.Now().Add(-window)
+	const filter = "FROM pair_snapshots WHERE timestamp >= $1 AND chain_id = 'solana' AND quote_token_address = $2"
+
+	if err := dbPool.QueryRow(ctx, "SELECT count(*) "+filter, since, wrappedSOLMint).Scan(&profile.Samples); err != nil {
+		return profile, fmt.Errorf("counting snapshots: %w", err)
+	}
+	if profile.Samples == 0 {
+		return profile, fmt.Errorf("no snapshots in the last %v", window)
+	}
+
+	for name, expr := range profileMetrics {
+		query := fmt.Sprintf("SELECT percentile_cont(ARRAY[0.05, 0.5, 0.95]) WITHIN GROUP (ORDER BY (%s)::float8) %s", expr, filter)
+		var p []float64
+		if err := dbPool.QueryRow(ctx, query, since, wrappedSOLMint).Scan(&p); err != nil {
+			return profile, fmt.Errorf("computing %s percentiles: %w", name, err)
+		}
+		if len(p) != 3 {
+			return profile, fmt.Errorf("computing %s percentiles: got %d values", name, len(p))
+		}
+		profile.Metrics[name] = MetricPercentiles{P05: p[0], P50: p[1], P95: p[2]}
+	}
+	return profile, nil
+}
+
+// --- Preflight ---
+
+// One preflight check: Run returns nil on success; Hint says what to fix on failure
+type preflightCheck struct {
+	Name string
+	Hint string
+	Run  func(ctx context.Context) (detail string, err error)
+}
+
+const preflightCheckTimeout = 15 * time.Second
+
+// Runs every check (a failure doesn't stop the rest), prints a pass/fail checklist and
+// returns true if all passed
+func runPreflight(checks []preflightCheck) bool {
+	passed := 0
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), preflightCheckTimeout)
+		detail, err := c.Run(ctx)
+		cancel()
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n   → %s\n", c.Name, err, c.Hint)
+			continue
+		}
+		passed++
+		if detail != "" {
+			fmt.Printf("✅ %s (%s)\n", c.Name, detail)
+		} else {
+			fmt.Printf("✅ %s\n", c.Name)
+		}
+	}
+	fmt.Printf("%d/%d checks passed\n", passed, len(checks))
+	return passed == len(checks)
+}
+
+// Creates and removes a temp file in dir (creating dir if needed, as the collector would)
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// DB reachability, one decoded DexScreener poll per configured base, and write access
+// to the dead-letter and working directories
+func collectorPreflightChecks() []preflightCheck {
+	checks := []preflightCheck{dbPreflightCheck(dbConnectionString)}
+	for _, b := range apiBases.bases {
+		base := b.URL
+		checks = append(checks, preflightCheck{
+			Name: "DexScreener fetch from " + redactURL(base),
+			Hint: "check -dexscreener-url / DEXSCREENER_URL and network access; a 429 means this base is rate limiting you",
+			Run: func(ctx context.Context) (string, error) {
+				pairs, err := fetchFromBase(ctx, base)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d pairs decoded for %d chain(s)", len(pairs), len(collectChains)), nil
+			},
+		})
+	}
+	for _, dir := range []string{deadLetterDir, "."} {
+		checks = append(checks, preflightCheck{
+			Name: "Write access to " + dir,
+			Hint: "run from a directory the collector's user can write to, or fix its permissions",
+			Run: func(context.Context) (string, error) {
+				return "", checkWritableDir(dir)
+			},
+		})
+	}
+	return checks
+}
+
+// Connects to and pings the database at dsn
+func dbPreflightCheck(dsn string) preflightCheck {
+	return preflightCheck{
+		Name: "Database connection",
+		Hint: "check dbConnectionString (host, port, credentials, sslmode) and that Postgres is running",
+		Run: func(ctx context.Context) (string, error) {
+			conn, err := pgx.Connect(ctx, dsn)
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close(context.Background())
+			if err := conn.Ping(ctx); err != nil {
+				return "", err
+			}
+			return redactURL(dsn), nil
+		},
+	}
+}
+
+func runBuildProfile(args []string) {
+	fs := flag.NewFlagSet("build-profile", flag.ExitOnError)
+	out := fs.String("out", defaultProfileFile, "Where to write the profile JSON")
+	window := fs.Duration("window", defaultProfileWindow, "How much snapshot history to use")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	profile, err := buildNormalizationProfile(ctx, *window)
+	if err != nil {
+		log.Fatalf("❌ Failed to build normalization profile: %v", err)
+	}
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		log.Fatalf("❌ Failed to encode normalization profile: %v", err)
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("❌ Failed to write %s: %v", *out, err)
+	}
+	log.Printf("✅ Wrote normalization profile from %d snapshots (%v) to %s", profile.Samples, *window, *out)
+}
+
 // --- Main Polling Loop ---
-func runCollector() {
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
+// Polls until ctx is cancelled. A cancelled ctx also aborts the in-flight fetch; an
+// insert already under way gets its own timeout so a batch isn't cut off mid-copy.
+// Stream updates (nil channel when not streaming) are batched and stored from this same
+// loop, so the insert path and its outage state are never used concurrently.
+func runCollector(ctx context.Context, updates <-chan streamUpdate) {
+	timer := time.NewTimer(jitteredInterval(pollInterval, pollJitterPercent))
+	defer timer.Stop()
+	flushTicker := time.NewTicker(streamFlushInterval)
+	defer flushTicker.Stop()
+	pending := map[string]streamUpdate{} // PairAddress -> latest unflushed update
+	streamedAt := map[string]time.Time{} // PairAddress -> last stream update stored
+	flushStream := func() {
+		if len(pending) == 0 {
+			return
+		}
+		snapshots := make([]PairSnapshotData, 0, len(pending))
+		for addr, u := range pending {
+			if snap, ok := snapshotFromPair(u.Pair, u.Received); ok {
+				snapshots = append(snapshots, snap)
+			}
+			streamedAt[addr] = u.Received
+		}
+		clear(pending)
+		if len(snapshots) > 0 && storeSnapshots(snapshots) {
+			log.Printf("⚡ Inserted %d streamed snapshots", len(snapshots))
+		}
+	}
+
+	log.Printf("Collector started. Polling every %v (±%.0f%% jitter). Saving to DB.", pollInterval, pollJitterPercent)
 
-	log.Printf("Collector started. Polling every %v. Saving to DB.", pollInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			flushStream()
+			log.Println("🛑 Collector stopping.")
+			apiBases.LogStats()
+			return
+		case u := <-updates:
+			pending[u.Pair.PairAddress] = u
+			if len(pending) >= streamMaxBatch {
+				flushStream()
+			}
+			continue
+		case <-flushTicker.C:
+			flushStream()
+			continue
+		case <-timer.C:
+			timer.Reset(jitteredInterval(pollInterval, pollJitterPercent)) // Re-arm before polling to keep the cadence
+		}
 
-	for range ticker.C {
 		pollStartTime := time.Now()
 		log.Printf("Polling API at %s...", pollStartTime.Format(time.RFC3339))
 
-		pairs, err := fetchDexScreenerData()
+		fetchCtx, cancelFetch := context.WithTimeout(ctx, apiTimeout)
+		pairs, err := fetchDexScreenerData(fetchCtx)
+		cancelFetch()
 		if err != nil {
 			log.Printf("⚠️ Error fetching API data: %v. Skipping this cycle.", err)
 			continue
@@ -244,61 +989,340 @@ func runCollector() {
 		now := time.Now().UTC() // Use UTC for consistency
 
 		var snapshots []PairSnapshotData
+		streamed := 0
 		for _, p := range pairs {
-			// Basic validation
-			if p.PairAddress == "" || p.BaseToken.Address == "" || p.QuoteToken.Address == "" {
-				log.Printf("⚠️ Skipping pair due to missing address: %+v", p)
+			if at, ok := streamedAt[p.PairAddress]; ok && now.Sub(at) < pollInterval {
+				streamed++ // The stream is keeping this pair current
 				continue
 			}
-			// Add more validation as needed (e.g., non-negative liquidity/volume)
-
-			snapshots = append(snapshots, PairSnapshotData{
-				Timestamp:         now,
-				PairAddress:       p.PairAddress,
-				BaseTokenAddress:  p.BaseToken.Address,
-				BaseTokenSymbol:   p.BaseToken.Symbol,
-				QuoteTokenAddress: p.QuoteToken.Address,
-				QuoteTokenSymbol:  p.QuoteToken.Symbol,
-				PriceNative:       parseFloat(p.PriceNative),
-				PriceUsd:          parseFloat(p.PriceUsd),
-				LiquidityUsd:      p.Liquidity.Usd,
-				VolumeM5:          p.Volume.M5,
-				VolumeH1:          p.Volume.H1,
-				VolumeH6:          p.Volume.H6,
-				VolumeH24:         p.Volume.H24,
-				PriceChangeM5:     p.PriceChange.M5,
-				PriceChangeH1:     p.PriceChange.H1,
-				PriceChangeH6:     p.PriceChange.H6,
-				PriceChangeH24:    p.PriceChange.H24,
-				TxnsM5Buys:        p.Txns.M5.Buys,
-				TxnsM5Sells:       p.Txns.M5.Sells,
-				TxnsH1Buys:        p.Txns.H1.Buys,
-				TxnsH1Sells:       p.Txns.H1.Sells,
-				PairCreatedAt:     time.Unix(p.PairCreatedAt/1000, 0), // Convert ms to time.Time
-			})
-		}
-
-		// Insert batch into database
-		dbCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second) // DB operation timeout
-		err = insertSnapshotBatch(dbCtx, snapshots)
-		cancel()
+			if snap, ok := snapshotFromPair(p, now); ok {
+				snapshots = append(snapshots, snap)
+			}
+		}
+		if streamed > 0 {
+			log.Printf("⚡ %d pairs covered by the stream; polling %d", streamed, len(snapshots))
+		}
+		if len(snapshots) == 0 {
+			continue // Nothing left to store; an empty batch would sit in the outage buffer
+		}
 
-		if err != nil {
-			log.Printf("❌ Failed to insert batch: %v", err)
-			// Optionally handle retries, etc.
-		} else {
+		if storeSnapshots(snapshots) {
 			log.Printf("✅ Inserted %d snapshots into DB. Cycle duration: %v",
 				len(snapshots), time.Since(pollStartTime))
 		}
 	}
 }
 
+// Converts an API pair into a row observed at ts; false if it lacks the addresses we key on
+func snapshotFromPair(p Pair, ts time.Time) (PairSnapshotData, bool) {
+	// Basic validation
+	if p.PairAddress == "" || p.BaseToken.Address == "" || p.QuoteToken.Address == "" {
+		log.Printf("⚠️ Skipping pair due to missing address: %+v", p)
+		return PairSnapshotData{}, false
+	}
+	// Add more validation as needed (e.g., non-negative liquidity/volume)
+
+	return PairSnapshotData{
+		Timestamp:         ts,
+		ChainID:           p.ChainID,
+		PairAddress:       p.PairAddress,
+		BaseTokenAddress:  p.BaseToken.Address,
+		BaseTokenSymbol:   p.BaseToken.Symbol,
+		QuoteTokenAddress: p.QuoteToken.Address,
+		QuoteTokenSymbol:  p.QuoteToken.Symbol,
+		PriceNative:       parseFloat(string(p.PriceNative)),
+		PriceUsd:          parseFloat(string(p.PriceUsd)),
+		LiquidityUsd:      float64(p.Liquidity.Usd),
+		VolumeM5:          float64(p.Volume.M5),
+		VolumeH1:          float64(p.Volume.H1),
+		VolumeH6:          float64(p.Volume.H6),
+		VolumeH24:         float64(p.Volume.H24),
+		PriceChangeM5:     float64(p.PriceChange.M5),
+		PriceChangeH1:     float64(p.PriceChange.H1),
+		PriceChangeH6:     float64(p.PriceChange.H6),
+		PriceChangeH24:    float64(p.PriceChange.H24),
+		TxnsM5Buys:        int(p.Txns.M5.Buys),
+		TxnsM5Sells:       int(p.Txns.M5.Sells),
+		TxnsH1Buys:        int(p.Txns.H1.Buys),
+		TxnsH1Sells:       int(p.Txns.H1.Sells),
+		PairCreatedAt:     pairCreatedTime(p.PairCreatedAt),
+	}, true
+}
+
+// --- Streaming ---
+
+type streamUpdate struct {
+	Pair     Pair
+	Received time.Time
+}
+
+// Anything that can push pair updates: the HTTP line stream below, or a stub
+type pairStreamSource interface {
+	// Streams updates until the connection ends or ctx is cancelled. Sending blocks when
+	// the queue is full, which is the backpressure on the source.
+	Stream(ctx context.Context, updates chan<- streamUpdate) error
+}
+
+// NDJSON or SSE over a long-lived HTTP GET. Each line (or "data:" payload) is a pair
+// object, a bare array of pairs or a {"pairs": [...]} envelope.
+type httpLineStream struct {
+	URL string
+}
+
+func (s httpLineStream) Stream(ctx context.Context, updates chan<- streamUpdate) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return fmt.Errorf("error building stream request: %w", err)
+	}
+	req.Header.Set("Accept", "application/x-ndjson, text/event-stream")
+	resp, err := http.DefaultClient.Do(req) // No timeout: the response never ends by design
+	if err != nil {
+		return fmt.Errorf("stream connect error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stream non-OK HTTP status: %d", resp.StatusCode)
+	}
+	log.Printf("⚡ Stream connected: %s", redactURL(s.URL))
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), streamMaxLineBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if data, isSSE := bytes.CutPrefix(line, []byte("data:")); isSSE {
+			line = bytes.TrimSpace(data)
+		}
+		if len(line) == 0 || (line[0] != '{' && line[0] != '[') {
+			continue // Blank keep-alives, SSE comments and event/id fields
+		}
+		for _, p := range decodeStreamPairs(line) {
+			select {
+			case updates <- streamUpdate{Pair: p, Received: time.Now().UTC()}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("stream read error: %w", err)
+	}
+	return io.EOF // Server closed the stream
+}
+
+// Pairs in one stream message, kept to the collected chains; a bare pair object
+// (no "pairs"/"pair" envelope) counts as one update
+func decodeStreamPairs(msg []byte) []Pair {
+	rawPairs, err := rawDexScreenerPairs(msg)
+	if err == nil && len(rawPairs) == 0 && msg[0] == '{' {
+		rawPairs = []json.RawMessage{msg}
+	}
+	if err != nil {
+		log.Printf("⚠️ Skipping malformed stream message: %s", string(msg[:min(len(msg), 200)]))
+		return nil
+	}
+	pairs := make([]Pair, 0, len(rawPairs))
+	for _, rawPair := range rawPairs {
+		var p Pair
+		if err := json.Unmarshal(rawPair, &p); err != nil || p.PairAddress == "" {
+			continue
+		}
+		pairs = append(pairs, p)
+	}
+	return filterByChain(pairs, collectChains)
+}
+
+// Keeps src connected until ctx is cancelled, reconnecting with jittered backoff that
+// resets once a connection has stayed up past the first reconnect delay
+func runStream(ctx context.Context, src pairStreamSource, updates chan<- streamUpdate) {
+	failures := 0
+	for {
+		started := time.Now()
+		err := src.Stream(ctx, updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > streamReconnectDelay {
+			failures = 0
+		}
+		failures++
+		delay := streamReconnectPolicy.Delay(failures)
+		log.Printf("⚡ Stream disconnected (%v). Reconnecting in %v; polling covers all pairs meanwhile", err, delay.Round(time.Millisecond))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// --- DB Outage Handling ---
+
+// Inserts this poll's batch, or queues it when the DB is unavailable. Returns true if the
+// batch reached the DB. State machine:
+//
+//	up   --(dbDownAfterFailures consecutive insert failures)--> down
+//	down --(successful ping at nextAttempt, buffer flushed)--> up
+//
+// Failed batches are never dropped: they wait in the buffer, and the oldest spill to
+// deadLetterDir once more than dbBufferMaxBatches are waiting.
+func storeSnapshots(snapshots []PairSnapshotData) bool {
+	if dbState.down {
+		enqueueSnapshots(snapshots)
+		if time.Now().Before(dbState.nextAttempt) {
+			return false
+		}
+		if err := pingDB(); err != nil {
+			dbState.reconnectAttempts++
+			dbState.backoff = dbReconnectPolicy.Delay(dbState.reconnectAttempts + 1)
+			dbState.nextAttempt = time.Now().Add(dbState.backoff)
+			log.Printf("🔌 DB still unreachable (%v). %d batches buffered; next attempt in %v",
+				err, len(dbState.buffer), dbState.backoff)
+			return false
+		}
+		log.Printf("🔌 DB reachable again after %v. Flushing %d buffered batches...",
+			time.Since(dbState.downSince).Round(time.Second), len(dbState.buffer))
+		if flushed := flushBuffer(); flushed {
+			dbState = dbHealth{}
+			log.Println("✅ DB state: UP (buffer flushed)")
+		}
+		return false // This poll went through the buffer; flushBuffer logged it
+	}
+
+	if err := insertWithTimeout(snapshots); err != nil {
+		dbState.consecutiveFailures++
+		log.Printf("❌ Failed to insert batch (%d/%d consecutive failures): %v",
+			dbState.consecutiveFailures, dbDownAfterFailures, err)
+		enqueueSnapshots(snapshots)
+		if dbState.consecutiveFailures >= dbDownAfterFailures {
+			dbState.down = true
+			dbState.downSince = time.Now()
+			dbState.backoff = dbReconnectPolicy.Delay(1)
+			dbState.nextAttempt = time.Now().Add(dbState.backoff)
+			log.Printf("🔌 DB state: DOWN. Buffering up to %d batches, spilling older ones to %s/",
+				dbBufferMaxBatches, deadLetterDir)
+		}
+		return false
+	}
+
+	dbState.consecutiveFailures = 0
+	if len(dbState.buffer) > 0 {
+		flushBuffer() // Catch up batches left by failures that didn't reach the down threshold
+	}
+	return true
+}
+
+func insertWithTimeout(snapshots []PairSnapshotData) error {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second) // DB operation timeout
+	defer cancel()
+	return insertBatch(dbCtx, snapshots)
+}
+
+func pingDB() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return pingPool(ctx)
+}
+
+// Queues a batch, spilling the oldest queued batch to a dead-letter file when full
+func enqueueSnapshots(snapshots []PairSnapshotData) {
+	if len(snapshots) == 0 {
+		return
+	}
+	dbState.buffer = append(dbState.buffer, snapshots)
+	if len(dbState.buffer) <= dbBufferMaxBatches {
+		return
+	}
+	oldest := dbState.buffer[0]
+	dbState.buffer = dbState.buffer[1:]
+	if path, err := writeDeadLetter(oldest); err != nil {
+		log.Printf("❌ Buffer full and dead-letter write failed, dropping %d snapshots: %v", len(oldest), err)
+	} else {
+		log.Printf("📦 Buffer full: spilled %d snapshots to %s", len(oldest), path)
+	}
+}
+
+// Inserts buffered batches oldest first, stopping at the first failure (the rest stay
+// queued). Returns true if the buffer was emptied.
+func flushBuffer() bool {
+	for len(dbState.buffer) > 0 {
+		if err := insertWithTimeout(dbState.buffer[0]); err != nil {
+			log.Printf("❌ Flush interrupted with %d batches left: %v", len(dbState.buffer), err)
+			dbState.nextAttempt = time.Now().Add(dbState.backoff)
+			return false
+		}
+		log.Printf("✅ Flushed buffered batch from %s (%d snapshots)",
+			batchStart(dbState.buffer[0]).Format(time.RFC3339), len(dbState.buffer[0]))
+		dbState.buffer = dbState.buffer[1:]
+	}
+	return true
+}
+
+// Writes a batch as JSON lines under deadLetterDir, one file per poll, for later replay
+func writeDeadLetter(snapshots []PairSnapshotData) (string, error) {
+	if err := os.MkdirAll(deadLetterDir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("snapshots-%s.jsonl", batchStart(snapshots).Format("20060102T150405Z"))
+	path := filepath.Join(deadLetterDir, name)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, snap := range snapshots {
+		if err := enc.Encode(snap); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// Earliest snapshot time in a batch (a stream batch mixes receive times); zero if empty
+func batchStart(snapshots []PairSnapshotData) time.Time {
+	var start time.Time
+	for _, snap := range snapshots {
+		if start.IsZero() || snap.Timestamp.Before(start) {
+			start = snap.Timestamp
+		}
+	}
+	return start
+}
+
 // --- Main Function ---
 func main() {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 
-	var err error
+	flag.StringVar(&dexScreenerBaseURL, "dexscreener-url", envOrDefault("DEXSCREENER_URL", defaultDexScreenerBaseURL), "DexScreener API base URL(s), comma-separated to rotate across mirrors/proxies (env DEXSCREENER_URL)")
+	chainList := flag.String("chains", defaultCollectChains, "Comma-separated DexScreener chain IDs to collect, e.g. solana,base,ethereum")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration as JSON (credentials redacted) and exit")
+	useTimescale := flag.Bool("timescale", false, "Store pair_snapshots as a TimescaleDB hypertable when the extension is installed")
+	flag.StringVar(&streamURL, "stream-url", streamURL, "HTTP stream (NDJSON/SSE) of pair updates to insert as they arrive, alongside polling (env STREAM_URL; empty = off)")
+	flag.Parse()
+	bases, err := newBaseRotation(dexScreenerBaseURL, baseRotationStrategy)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	apiBases = bases
+	collectChains = parseChainList(*chainList)
+	if len(collectChains) == 0 {
+		log.Fatalf("❌ -chains must name at least one chain")
+	}
+	if *printConfig {
+		out, err := json.MarshalIndent(resolveCollectorConfig(), "", "  ")
+		if err != nil {
+			log.Fatalf("❌ Error encoding config: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	if flag.Arg(0) == "preflight" {
+		if !runPreflight(collectorPreflightChecks()) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize database connection pool
 	dbPool, err = pgxpool.New(context.Background(), dbConnectionString)
@@ -314,8 +1338,24 @@ func main() {
 	}
 	log.Println("✅ Database connection established.")
 
-	// Start the collector loop
-	runCollector()
+	if err := ensureSchema(context.Background(), *useTimescale); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if flag.Arg(0) == "build-profile" {
+		runBuildProfile(flag.Args()[1:])
+		return
+	}
+
+	// Start the collector loop; Ctrl+C / SIGTERM stops it cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var updates chan streamUpdate // nil (never ready) unless streaming
+	if streamURL != "" {
+		updates = make(chan streamUpdate, streamBufferSize)
+		go runStream(ctx, httpLineStream{URL: streamURL}, updates)
+	}
+	runCollector(ctx, updates)
 }
 
 // Helper for min function used in logging JSON parse errors
@@ -0,0 +1,489 @@
+// collector_test.go
+//
+// Run with the file it tests, since every .go file here is its own program:
+//
+//	go test collector.go collector_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// --- Chain Filter ---
+
+// A search response mixing chains, as DexScreener returns it
+const mixedChainSearchResponse = `{"schemaVersion":"1.0.0","pairs":[
+	{"chainId":"solana","pairAddress":"SolPair","baseToken":{"address":"SolMint"},"quoteToken":{"address":"SolQuote"}},
+	{"chainId":"base","pairAddress":"BasePair","baseToken":{"address":"BaseMint"},"quoteToken":{"address":"BaseQuote"}},
+	{"chainId":"ethereum","pairAddress":"EthPair","baseToken":{"address":"EthMint"},"quoteToken":{"address":"EthQuote"}},
+	{"chainId":"bsc","pairAddress":"BscPair","baseToken":{"address":"BscMint"},"quoteToken":{"address":"BscQuote"}}
+]}`
+
+func TestFetchKeepsConfiguredChains(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mixedChainSearchResponse))
+	}))
+	defer srv.Close()
+
+	configured := collectChains
+	t.Cleanup(func() { collectChains = configured })
+	for _, c := range []struct {
+		chains string // As passed to -chains
+		want   []string
+	}{
+		{"solana", []string{"SolPair"}},
+		{"solana,base", []string{"SolPair", "BasePair"}},
+		{" Base , ETHEREUM ,", []string{"BasePair", "EthPair"}},
+		{"arbitrum", nil},
+	} {
+		collectChains = parseChainList(c.chains)
+		pairs, err := fetchFromBase(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatalf("-chains %q: %v", c.chains, err)
+		}
+		var got []string
+		for _, p := range pairs {
+			got = append(got, p.PairAddress)
+			if snap, ok := snapshotFromPair(p, time.Now()); !ok || snap.ChainID != p.ChainID {
+				t.Errorf("%s: snapshot chain %q (ok %t), want %q", p.PairAddress, snap.ChainID, ok, p.ChainID)
+			}
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("-chains %q kept %v, want %v", c.chains, got, c.want)
+		}
+	}
+}
+
+// --- Decoding ---
+
+func TestRawDexScreenerPairsShapes(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		want    int
+	}{
+		{"testdata/dexscreener/search_pairs.json", 2},    // {"pairs": [...]}
+		{"testdata/dexscreener/pair_by_address.json", 1}, // {"pair": {...}}
+		{"testdata/dexscreener/token_pairs.json", 2},     // [...]
+	} {
+		body, err := os.ReadFile(c.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := rawDexScreenerPairs(body)
+		if err != nil || len(raw) != c.want {
+			t.Errorf("%s: %d pairs, %v, want %d", c.fixture, len(raw), err, c.want)
+		}
+	}
+}
+
+// --- Schema ---
+
+// Answers the extension query with a canned result
+type stubQuerier struct {
+	installed bool
+	err       error
+}
+
+type stubRow stubQuerier
+
+func (q stubQuerier) QueryRow(context.Context, string, ...any) pgx.Row { return stubRow(q) }
+
+func (r stubRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*bool) = r.installed
+	return nil
+}
+
+func TestTimescaleInstalled(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		db      stubQuerier
+		want    bool
+		wantErr bool
+	}{
+		{"installed", stubQuerier{installed: true}, true, false},
+		{"not installed", stubQuerier{installed: false}, false, false},
+		{"query fails", stubQuerier{err: errors.New("permission denied for pg_extension")}, false, true},
+	} {
+		got, err := timescaleInstalled(context.Background(), c.db)
+		if got != c.want || (err != nil) != c.wantErr {
+			t.Errorf("%s: installed %t, err %v; want %t, error %t", c.name, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+// --- Base Rotation ---
+
+// URLs of the next n picks at at, recording each as a success
+func picks(r *baseRotation, n int, at time.Time) []string {
+	var urls []string
+	for range n {
+		b := r.Pick(at)
+		r.Record(b, time.Millisecond, nil, at)
+		urls = append(urls, b.URL)
+	}
+	return urls
+}
+
+func testRotation(t *testing.T, strategy string) *baseRotation {
+	t.Helper()
+	r, err := newBaseRotation("http://a, http://b,http://c", strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRotationRoundRobin(t *testing.T) {
+	r := testRotation(t, "round-robin")
+	want := []string{"http://a", "http://b", "http://c", "http://a", "http://b", "http://c"}
+	if got := picks(r, 6, time.Now()); !slices.Equal(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+}
+
+func TestRotationCoolsDownAfter429(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+	r := testRotation(t, "round-robin")
+	start := time.Now()
+	b := r.Pick(start)                                                         // a
+	r.Record(r.Pick(start), 0, fmt.Errorf("fetch: %w", errRateLimited), start) // b answers 429
+
+	during := start.Add(rateLimitCooldown / 2)
+	if got := picks(r, 4, during); slices.Contains(got, "http://b") {
+		t.Errorf("picked %v during b's cooldown, want b passed over", got)
+	}
+	if got := picks(r, 3, start.Add(rateLimitCooldown)); !slices.Contains(got, "http://b") {
+		t.Errorf("picked %v after b's cooldown, want b back in rotation", got)
+	}
+
+	for _, base := range r.bases { // Everyone rate limited: the soonest out of cooldown still serves
+		r.Record(base, 0, errRateLimited, start)
+	}
+	b.CooldownUntil = start.Add(time.Second)
+	if got := r.Pick(start); got != b {
+		t.Errorf("all bases cooling down: picked %s, want %s (cooldown ends first)", got.URL, b.URL)
+	}
+}
+
+func TestRotationLeastErrored(t *testing.T) {
+	r := testRotation(t, "least-errored")
+	start := time.Now()
+	failed := errors.New("connection reset")
+	r.Record(r.bases[0], 0, failed, start)                  // a errored first
+	r.Record(r.bases[1], 0, failed, start.Add(time.Second)) // then b
+	if got := picks(r, 3, start.Add(time.Minute)); !slices.Equal(got, []string{"http://c", "http://c", "http://c"}) {
+		t.Errorf("picked %v, want c (never errored) every time", got)
+	}
+	r.Record(r.bases[2], 0, failed, start.Add(2*time.Second)) // c errors last
+	if got := r.Pick(start.Add(time.Minute)); got.URL != "http://a" {
+		t.Errorf("picked %s, want http://a (its last error is the oldest)", got.URL)
+	}
+}
+
+// --- Preflight ---
+
+// Runs the check whose name starts with prefix; fails the test if there's none
+func runCheck(t *testing.T, checks []preflightCheck, prefix string) error {
+	t.Helper()
+	for _, c := range checks {
+		if strings.HasPrefix(c.Name, prefix) {
+			_, err := c.Run(context.Background())
+			return err
+		}
+	}
+	t.Fatalf("no %q check", prefix)
+	return nil
+}
+
+// Serves h as the only DexScreener base
+func useDexScreenerBase(t *testing.T, h http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	bases, err := newBaseRotation(srv.URL, baseRotationStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured := apiBases
+	apiBases = bases
+	t.Cleanup(func() { apiBases = configured })
+}
+
+func TestPreflightFailures(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+	healthy := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(mixedChainSearchResponse)) }
+
+	for _, c := range []struct {
+		name  string
+		check string
+		stub  func(t *testing.T, dir string)
+	}{
+		{"DexScreener down", "DexScreener fetch", func(t *testing.T, _ string) {
+			useDexScreenerBase(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			})
+		}},
+		{"DexScreener rate limiting", "DexScreener fetch", func(t *testing.T, _ string) {
+			useDexScreenerBase(t, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) })
+		}},
+		{"DexScreener not JSON", "DexScreener fetch", func(t *testing.T, _ string) {
+			useDexScreenerBase(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>captive portal</html>")) })
+		}},
+		{"dead-letter directory blocked", "Write access to " + deadLetterDir, func(t *testing.T, _ string) {
+			useDexScreenerBase(t, healthy)
+			if err := os.WriteFile(deadLetterDir, nil, 0o644); err != nil { // A file where the directory goes
+				t.Fatal(err)
+			}
+		}},
+		{"working directory gone", "Write access to .", func(t *testing.T, dir string) {
+			useDexScreenerBase(t, healthy)
+			if err := os.Remove(dir); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			c.stub(t, dir)
+			if err := runCheck(t, collectorPreflightChecks(), c.check); err == nil {
+				t.Errorf("%s check passed", c.check)
+			}
+		})
+	}
+
+	t.Run("healthy", func(t *testing.T) { // The same checks pass without the stubs' faults
+		t.Chdir(t.TempDir())
+		useDexScreenerBase(t, healthy)
+		checks := collectorPreflightChecks()
+		for _, check := range []string{"DexScreener fetch", "Write access to " + deadLetterDir, "Write access to ."} {
+			if err := runCheck(t, checks, check); err != nil {
+				t.Errorf("%s check failed: %v", check, err)
+			}
+		}
+	})
+
+	t.Run("database unreachable", func(t *testing.T) {
+		check := dbPreflightCheck("postgres://preflight@127.0.0.1:1/none?connect_timeout=2") // Nothing listens on port 1
+		if err := runCheck(t, []preflightCheck{check}, "Database connection"); err == nil {
+			t.Error("Database connection check passed")
+		}
+	})
+}
+
+// --- DB Outage Handling ---
+
+// A database the test takes down and brings back; records the batches it accepted
+type fakeDB struct {
+	up       bool
+	pings    int
+	inserted []time.Time // Timestamp of each accepted batch, in insert order
+}
+
+func useFakeDB(t *testing.T) *fakeDB {
+	t.Helper()
+	t.Chdir(t.TempDir()) // Any dead-letter spill lands here
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	db := &fakeDB{up: true}
+	insertBatch = func(_ context.Context, snapshots []PairSnapshotData) error {
+		if !db.up {
+			return errors.New("connection refused")
+		}
+		db.inserted = append(db.inserted, snapshots[0].Timestamp)
+		return nil
+	}
+	pingPool = func(context.Context) error {
+		db.pings++
+		if !db.up {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	dbState = dbHealth{}
+	t.Cleanup(func() {
+		insertBatch, pingPool = insertSnapshotBatch, func(ctx context.Context) error { return dbPool.Ping(ctx) }
+		dbState = dbHealth{}
+		log.SetOutput(out)
+	})
+	return db
+}
+
+func TestDBDownBuffersThenFlushesOnRecovery(t *testing.T) {
+	db := useFakeDB(t)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	poll := 0
+	store := func() bool {
+		at := start.Add(time.Duration(poll) * pollInterval)
+		poll++
+		return storeSnapshots([]PairSnapshotData{{Timestamp: at, ChainID: "solana", PairAddress: "P"}})
+	}
+
+	if !store() {
+		t.Fatal("insert failed with the DB up")
+	}
+	db.up = false
+	for i := 1; i <= dbDownAfterFailures; i++ {
+		if store() {
+			t.Fatalf("failure %d: reported stored with the DB down", i)
+		}
+		if want := i >= dbDownAfterFailures; dbState.down != want {
+			t.Fatalf("after %d failed inserts: down %t, want %t", i, dbState.down, want)
+		}
+	}
+
+	store() // Reconnect not due yet: buffered without a ping
+	if db.pings != 0 {
+		t.Errorf("pinged %d times before the reconnect backoff elapsed", db.pings)
+	}
+	dbState.nextAttempt = time.Time{}
+	store() // Due, but the DB is still down
+	if db.pings != 1 || !dbState.down || !dbState.nextAttempt.After(time.Now()) {
+		t.Errorf("failed reconnect: %d pings, down %t, next attempt %v, want 1, still down, rescheduled", db.pings, dbState.down, dbState.nextAttempt)
+	}
+
+	db.up = true
+	dbState.nextAttempt = time.Time{}
+	store()
+	if dbState.down || len(dbState.buffer) != 0 {
+		t.Fatalf("after recovery: down %t with %d batches buffered, want up and flushed", dbState.down, len(dbState.buffer))
+	}
+	if len(db.inserted) != poll {
+		t.Fatalf("DB holds %d of %d polled batches", len(db.inserted), poll)
+	}
+	for i, at := range db.inserted {
+		if want := start.Add(time.Duration(i) * pollInterval); !at.Equal(want) {
+			t.Errorf("batch %d inserted is from %v, want %v (oldest first)", i, at, want)
+		}
+	}
+	if !store() {
+		t.Error("insert after recovery went through the buffer, want direct")
+	}
+}
+
+func TestBufferSkipsEmptyBatches(t *testing.T) {
+	useFakeDB(t)
+	enqueueSnapshots(nil)
+	if len(dbState.buffer) != 0 {
+		t.Fatalf("%d batches buffered from an empty one, want 0", len(dbState.buffer))
+	}
+
+	first := time.Date(2025, 1, 1, 0, 0, 5, 0, time.UTC)
+	batch := []PairSnapshotData{ // A stream batch: pairs in map order, not receive order
+		{Timestamp: first.Add(3 * time.Second), PairAddress: "B"},
+		{Timestamp: first, PairAddress: "A"},
+	}
+	path, err := writeDeadLetter(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(deadLetterDir, "snapshots-20250101T000005Z.jsonl"); path != want {
+		t.Errorf("dead letter written to %s, want %s (named for the batch's earliest snapshot)", path, want)
+	}
+}
+
+// --- Streaming ---
+
+// Sends its pairs once, then holds the connection open until the collector stops
+type stubStream struct {
+	pairs []Pair
+	sent  chan struct{}
+}
+
+func (s stubStream) Stream(ctx context.Context, updates chan<- streamUpdate) error {
+	for _, p := range s.pairs {
+		updates <- streamUpdate{Pair: p, Received: time.Now().UTC()}
+	}
+	close(s.sent)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func streamPair(addr, priceUsd string) Pair {
+	return Pair{ChainID: "solana", PairAddress: addr, BaseToken: Token{Address: addr + "Mint"},
+		QuoteToken: Token{Address: "SolQuote"}, PriceUsd: flexString(priceUsd)}
+}
+
+// Runs the stream into the collector until src has sent everything, then stops both.
+// Stopping flushes what's pending, so that's the one stream batch stored.
+func collectStream(t *testing.T, src stubStream) {
+	t.Helper()
+	useDexScreenerBase(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(mixedChainSearchResponse)) })
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan streamUpdate) // Unbuffered: each send returns once the collector holds it
+	go runStream(ctx, src, updates)
+	done := make(chan struct{})
+	go func() {
+		runCollector(ctx, updates)
+		close(done)
+	}()
+	<-src.sent
+	cancel()
+	<-done
+}
+
+func TestStreamUpdatesReachInsert(t *testing.T) {
+	useFakeDB(t)
+	var stored [][]PairSnapshotData
+	insertBatch = func(_ context.Context, snapshots []PairSnapshotData) error {
+		stored = append(stored, snapshots)
+		return nil
+	}
+
+	collectStream(t, stubStream{sent: make(chan struct{}), pairs: []Pair{
+		streamPair("A", "1.0"),
+		streamPair("B", "2.0"),
+		streamPair("A", "1.5"),                      // Supersedes A's first update
+		{ChainID: "solana", PairAddress: "NoMints"}, // Can't be keyed; dropped
+	}})
+	if len(stored) != 1 {
+		t.Fatalf("%d batches inserted, want 1", len(stored))
+	}
+	prices := map[string]float64{}
+	for _, snap := range stored[0] {
+		prices[snap.PairAddress] = snap.PriceUsd
+	}
+	if want := map[string]float64{"A": 1.5, "B": 2.0}; !maps.Equal(prices, want) {
+		t.Errorf("inserted %v, want %v (latest update per pair)", prices, want)
+	}
+}
+
+func TestEmptyStreamBatchNotBuffered(t *testing.T) {
+	db := useFakeDB(t)
+	db.up = false
+	dbState = dbHealth{down: true, nextAttempt: time.Now().Add(time.Hour)}
+
+	collectStream(t, stubStream{sent: make(chan struct{}), pairs: []Pair{{ChainID: "solana", PairAddress: "NoMints"}}})
+	if len(dbState.buffer) != 0 {
+		t.Fatalf("%d batches buffered from a stream flush with nothing to store, want 0", len(dbState.buffer))
+	}
+
+	db.up = true
+	dbState.nextAttempt = time.Time{}
+	storeSnapshots([]PairSnapshotData{{Timestamp: time.Now(), ChainID: "solana", PairAddress: "P"}}) // Recovers and flushes
+	if dbState.down || len(db.inserted) != 1 {
+		t.Errorf("after recovery: down %t, %d batches inserted, want up with 1", dbState.down, len(db.inserted))
+	}
+}
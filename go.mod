@@ -5,6 +5,7 @@ go 1.24.1
 require (
 	github.com/gagliardetto/solana-go v1.12.0
 	github.com/jackc/pgx/v5 v5.7.4
+	golang.org/x/text v0.21.0
 )
 
 require (
@@ -36,5 +37,4 @@ require (
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/term v0.27.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 )
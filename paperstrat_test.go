@@ -0,0 +1,3735 @@
+// paperstrat_test.go
+//
+// Run with the file it tests, since every .go file here is its own program:
+//
+//	go test paperstrat.go paperstrat_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// go test -run ReplayGolden -update-golden paperstrat.go paperstrat_test.go rewrites the
+// golden files, for when a strategy change is meant to change behavior
+var updateGolden = flag.Bool("update-golden", false, "Write each replay fixture's golden file instead of comparing")
+
+// --- Helpers ---
+
+var testStart = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Fresh backtest-mode bot: simulated clock at testStart, every log and state file in a
+// temp dir (also the working directory, so nothing lands in the repo), logs silenced
+// unless -v, and the cross-cycle globals runScan keeps reset
+func newTestBot(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if !testing.Verbose() {
+		out := log.Writer()
+		log.SetOutput(io.Discard)
+		t.Cleanup(func() { log.SetOutput(out) })
+	}
+	backtesting, monitorOnly, signalsOnly = true, false, false
+	useRunLogDir(dir)
+	now = func() time.Time { return testStart }
+	scanState, scanCycles, emptyCycles = newScanState(), 0, 0
+	pendingOrder, solUSDHistory = PendingOrder{}, nil
+	loggedSymbolDenials, loggedDataAnomalies = map[string]bool{}, map[string]string{}
+	recentOutcomes, effectiveMinScore = nil, minScoreToEnter
+	killSwitchEngaged, feedHash, feedRepeats, feedStalled = false, 0, 0, false
+	strategyProfiles, activeProfile = nil, defaultProfileName
+	balanceAlerts, cycleSkips = balanceAlertState{}, nil
+	statusLog = &logDeduper{mode: logDedupMode, runs: map[string]*dedupRun{}}
+	initPaperTrading()
+	return dir
+}
+
+// Points every run log at dir
+func useRunLogDir(dir string) {
+	tradesLogPath, walletLogPath = filepath.Join(dir, tradesLogFile), filepath.Join(dir, walletLogFile)
+	skipsLogPath, signalsLogPath = filepath.Join(dir, skipsLogFile), filepath.Join(dir, signalsLogFile)
+	funnelLogPath, featuresLogPath = filepath.Join(dir, funnelLogFile), filepath.Join(dir, featuresLogFile)
+}
+
+// Runs one cycle at the given time over pairs
+func scanAt(at time.Time, pairs []Pair) {
+	now = func() time.Time { return at }
+	fetchPairs = func(context.Context) ([]Pair, error) { return pairs, nil }
+	runScan(context.Background())
+}
+
+// Synthetic DexScreener batch: n SOL-quoted pairs that pass the filters, with prices,
+// volumes and txns drifting deterministically with cycle so history, streaks and exits
+// get exercised like in a live run
+func benchPairs(n, cycle int, solUSD float64) []Pair {
+	pairs := make([]Pair, n)
+	for i := range pairs {
+		phase := float64(cycle)*0.7 + float64(i)
+		price := 0.0001 * float64(1+i%97) * (1 + 0.05*math.Sin(phase))
+		addr := fmt.Sprintf("BenchPair%05d", i)
+		pairs[i] = Pair{
+			ChainID:       solanaChainID,
+			DexID:         "raydium",
+			PairAddress:   addr,
+			BaseToken:     Token{Address: "BenchMint" + addr[9:], Symbol: fmt.Sprintf("B%d", i)},
+			QuoteToken:    Token{Address: wrappedSOLMint, Symbol: "SOL"},
+			PriceNative:   flexString(strconv.FormatFloat(price, 'g', -1, 64)),
+			PriceUsd:      flexString(strconv.FormatFloat(price*solUSD, 'g', -1, 64)),
+			Txns:          Transactions{M5: BuysSells{Buys: flexInt(20 + (i+cycle)%30), Sells: flexInt(10 + (i*7+cycle)%25)}},
+			Volume:        Volume{M5: flexFloat(minVolume5mUSD * (2 + math.Abs(math.Cos(phase))*10))},
+			PriceChange:   PriceChange{M5: flexFloat(10 * math.Sin(phase)), H1: flexFloat(40 * math.Cos(phase/3))},
+			Liquidity:     Liquidity{Usd: flexFloat(minLiquidityUSD * float64(5+i%40))},
+			PairCreatedAt: flexInt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()),
+		}
+	}
+	return pairs
+}
+
+// --- Scan Benchmark ---
+
+const (
+	benchFixtureCycles = 32 // Distinct synthetic cycles replayed in rotation
+	benchSOLPriceUSD   = 150
+
+	// Ceiling for TestRunScanAllocs, so a hot-path regression fails the test run.
+	// Baseline at 200 pairs: ~3.0k allocs/cycle.
+	allocsCeilingPairs    = 200
+	maxAllocsPerScanCycle = 5000
+	allocsMeasuredCycles  = 50
+)
+
+// Batches for benchFixtureCycles cycles of n pairs
+func benchFixtures(n int) [][]Pair {
+	fixtures := make([][]Pair, benchFixtureCycles)
+	for c := range fixtures {
+		fixtures[c] = benchPairs(n, c, benchSOLPriceUSD)
+	}
+	return fixtures
+}
+
+// go test -bench RunScan -benchmem paperstrat.go paperstrat_test.go
+func BenchmarkRunScan(b *testing.B) {
+	for _, n := range []int{50, allocsCeilingPairs, 1000} {
+		b.Run(fmt.Sprintf("pairs=%d", n), func(b *testing.B) {
+			fixtures := benchFixtures(n)
+			newTestBot(b)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				scanAt(testStart.Add(time.Duration(i)*refreshInterval), fixtures[i%len(fixtures)])
+			}
+		})
+	}
+}
+
+func TestRunScanAllocs(t *testing.T) {
+	fixtures := benchFixtures(allocsCeilingPairs)
+	newTestBot(t)
+	cycle := 0
+	next := func() {
+		scanAt(testStart.Add(time.Duration(cycle)*refreshInterval), fixtures[cycle%len(fixtures)])
+		cycle++
+	}
+	for range benchFixtureCycles {
+		next() // Fill per-pair history first, as in a long run
+	}
+	allocs := testing.AllocsPerRun(allocsMeasuredCycles, next)
+	t.Logf("%d pairs: %.0f allocs/cycle", allocsCeilingPairs, allocs)
+	if allocs > maxAllocsPerScanCycle {
+		t.Errorf("runScan over %d pairs allocates %.0f times per cycle, more than the %d ceiling", allocsCeilingPairs, allocs, maxAllocsPerScanCycle)
+	}
+}
+
+// --- Replay Golden ---
+
+// Fixtures of recorded cycles, each with a <name>.golden.json next to it holding the
+// trades and ending balance they must produce
+const replayFixtureGlob = "testdata/replay/*.json"
+
+// What a replay must reproduce exactly. Trade IDs are left out: they carry random bits.
+type replayGolden struct {
+	Trades        []replayTrade `json:"trades"`
+	EndSOLBalance float64       `json:"endSolBalance"`
+	TradesMade    int           `json:"tradesMade"`
+}
+
+type replayTrade struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Action        string    `json:"action"`
+	Symbol        string    `json:"symbol"`
+	Reason        string    `json:"reason,omitempty"`
+	SOLAmount     float64   `json:"solAmount"`
+	TokenAmount   float64   `json:"tokenAmount"`
+	PriceNative   float64   `json:"priceNative"`
+	FeeSOL        float64   `json:"feeSOL"`
+	ProfitLossSOL float64   `json:"profitLossSOL,omitempty"`
+	Partial       bool      `json:"partial,omitempty"`
+}
+
+// Replays fixture through runScan from a fresh paper wallet and returns what it produced
+func replayFixtureRun(t *testing.T, fixture replayFixture) replayGolden {
+	t.Helper()
+	dir := newTestBot(t)
+	if len(fixture.TakeProfitLadder) > 0 {
+		configured := takeProfitLadder
+		takeProfitLadder = fixture.TakeProfitLadder
+		t.Cleanup(func() { takeProfitLadder = configured })
+	}
+	if len(fixture.Cycles) > 0 {
+		now = func() time.Time { return fixture.Cycles[0].Time }
+		initPaperTrading() // Wallet starts at the first cycle, like a backtest
+	}
+	for _, cycle := range fixture.Cycles {
+		scanAt(cycle.Time, cycle.Pairs)
+	}
+
+	entries, err := readRunLog[TradeLogEntry](dir, tradesLogFile, tradesLogFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	got := replayGolden{Trades: []replayTrade{}, EndSOLBalance: wallet.SOLBalance, TradesMade: wallet.TradesMade}
+	for _, e := range entries {
+		got.Trades = append(got.Trades, replayTrade{
+			Timestamp:     e.Timestamp,
+			Action:        e.Action,
+			Symbol:        e.Symbol,
+			Reason:        e.Reason,
+			SOLAmount:     e.SOLAmount,
+			TokenAmount:   e.TokenAmount,
+			PriceNative:   e.PriceNative,
+			FeeSOL:        e.FeeSOL,
+			ProfitLossSOL: e.ProfitLossSOL,
+			Partial:       e.Partial,
+		})
+	}
+	return got
+}
+
+// Replays each fixture in replayFixtureGlob and compares the trades and ending balance
+// with its golden file
+func TestReplayGolden(t *testing.T) {
+	matches, err := filepath.Glob(replayFixtureGlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []string
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".golden.json") {
+			fixtures = append(fixtures, m)
+		}
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("no replay fixtures in %s", replayFixtureGlob)
+	}
+	for _, path := range fixtures {
+		path, err := filepath.Abs(path) // newTestBot moves to a temp dir
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture replayFixture
+			if err := json.Unmarshal(data, &fixture); err != nil {
+				t.Fatalf("decoding %s: %v", path, err)
+			}
+			got := replayFixtureRun(t, fixture)
+
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false) // Keep "<" in exit reasons readable
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(got); err != nil {
+				t.Fatal(err)
+			}
+			goldenPath := strings.TrimSuffix(path, ".json") + ".golden.json"
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				t.Logf("wrote %s (%d trades)", goldenPath, len(got.Trades))
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v (run with -update-golden to create it)", err)
+			}
+			if bytes.Equal(want, buf.Bytes()) {
+				return
+			}
+			wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(buf.String(), "\n")
+			line := 0
+			for line < len(wantLines) && line < len(gotLines) && wantLines[line] == gotLines[line] {
+				line++
+			}
+			t.Errorf("replay differs from %s at line %d:\nwant: %s\ngot:  %s", filepath.Base(goldenPath), line+1,
+				strings.TrimSpace(lineAt(wantLines, line)), strings.TrimSpace(lineAt(gotLines, line)))
+		})
+	}
+}
+
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return "(end of file)"
+}
+
+// --- Backtest Pacing ---
+
+func TestParseReplaySpeed(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"max", 0, false},
+		{" MAX ", 0, false},
+		{"0", 0, false},
+		{"1", 1, false},
+		{"2.5", 2.5, false},
+		{"-1", 0, true},
+		{"fast", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	} {
+		got, err := parseReplaySpeed(c.in)
+		if got != c.want || (err != nil) != c.wantErr {
+			t.Errorf("parseReplaySpeed(%q) = %v, %v; want %v, error %t", c.in, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+// Backtest cycles an hour apart
+func hourlyCycles(n int) []snapshotCycle {
+	cycles := make([]snapshotCycle, n)
+	for i := range cycles {
+		cycles[i] = snapshotCycle{Time: testStart.Add(time.Duration(i) * time.Hour), Pairs: benchPairs(3, i, 150)}
+	}
+	return cycles
+}
+
+func TestBacktestMaxSpeedDoesNotSleep(t *testing.T) {
+	newTestBot(t)
+	speed, err := parseReplaySpeed("max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	runBacktest(context.Background(), hourlyCycles(24), speed)
+	if elapsed := time.Since(started); elapsed > time.Second || scanCycles != 24 {
+		t.Errorf("a day of hourly cycles at max speed ran %d cycles in %v, want all 24 without waiting", scanCycles, elapsed)
+	}
+
+	newTestBot(t)
+	started = time.Now()
+	runBacktest(context.Background(), hourlyCycles(3), 36_000) // 100ms per hour-long gap
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("two hour-long gaps at 36000x replayed in %v, want >= 200ms", elapsed)
+	}
+}
+
+// --- DexScreener Decoding ---
+
+// Payloads DexScreener has actually sent that once mis-decoded: null priceUsd on a fresh
+// pair, null liquidity.usd on a pair without a pool snapshot, and numerics as strings
+const (
+	nullPriceUSDPayload     = `{"schemaVersion":"1.0.0","pairs":[{"chainId":"solana","dexId":"pumpswap","pairAddress":"NullPriceUsdPair","baseToken":{"address":"NullPriceMint","symbol":"NEW"},"quoteToken":{"address":"So11111111111111111111111111111111111111112","symbol":"SOL"},"priceNative":"0.0000001234","priceUsd":null,"txns":{"m5":{"buys":3,"sells":1}},"volume":{"m5":812.5},"priceChange":{"m5":4.2},"liquidity":{"usd":15000,"base":1000000,"quote":50},"pairCreatedAt":1735689600000}]}`
+	nullLiquidityUSDPayload = `{"schemaVersion":"1.0.0","pairs":[{"chainId":"solana","dexId":"raydium","pairAddress":"NullLiquidityPair","baseToken":{"address":"NullLiqMint","symbol":"NOLIQ"},"quoteToken":{"address":"So11111111111111111111111111111111111111112","symbol":"SOL"},"priceNative":"0.00002","priceUsd":"0.003","txns":{"m5":{"buys":10,"sells":12}},"volume":{"m5":2500},"liquidity":{"usd":null,"base":null,"quote":null},"pairCreatedAt":1735689600000}]}`
+	stringNumericsPayload   = `{"schemaVersion":"1.0.0","pairs":[{"chainId":"solana","dexId":"meteora","pairAddress":"StringNumericsPair","baseToken":{"address":"StrNumMint","symbol":"STR"},"quoteToken":{"address":"So11111111111111111111111111111111111111112","symbol":"SOL"},"priceNative":0.00005,"priceUsd":"0.0075","txns":{"m5":{"buys":"42","sells":"17"}},"volume":{"m5":"12345.6"},"priceChange":{"m5":"-3.5","h1":" 12 "},"liquidity":{"usd":"98765.4"},"fdv":"NaN","pairCreatedAt":"1735689600000"}]}`
+)
+
+func TestDecodeDexScreenerPairsLenientFields(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+		check   func(t *testing.T, p Pair)
+	}{
+		{"null priceUsd", nullPriceUSDPayload, func(t *testing.T, p Pair) {
+			if p.PriceUsd != "" || p.PriceNative != "0.0000001234" || p.Liquidity.Usd != 15000 {
+				t.Errorf("got priceUsd %q priceNative %q liquidity %v", p.PriceUsd, p.PriceNative, p.Liquidity.Usd)
+			}
+		}},
+		{"null liquidity.usd", nullLiquidityUSDPayload, func(t *testing.T, p Pair) {
+			if p.Liquidity.Usd != 0 || p.Volume.M5 != 2500 || p.Txns.M5.Sells != 12 {
+				t.Errorf("got liquidity %v volume %v sells %d", p.Liquidity.Usd, p.Volume.M5, p.Txns.M5.Sells)
+			}
+		}},
+		{"string numerics", stringNumericsPayload, func(t *testing.T, p Pair) {
+			if p.PriceNative != "0.00005" || p.Txns.M5.Buys != 42 || p.Txns.M5.Sells != 17 ||
+				p.Volume.M5 != 12345.6 || p.PriceChange.M5 != -3.5 || p.PriceChange.H1 != 12 ||
+				p.Liquidity.Usd != 98765.4 || p.Fdv != 0 || p.PairCreatedAt != 1735689600000 {
+				t.Errorf("mis-decoded: %+v", p)
+			}
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pairs, err := decodeDexScreenerPairs([]byte(c.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pairs) != 1 {
+				t.Fatalf("decoded %d pairs, want 1", len(pairs))
+			}
+			c.check(t, pairs[0])
+		})
+	}
+}
+
+// Responses in each shape DexScreener answers in, and the pairs they hold
+var dexScreenerShapes = []struct {
+	fixture string
+	want    []string // Pair addresses, in order
+}{
+	{"testdata/dexscreener/search_pairs.json", []string{"8sLbNZoA1cfnvMJLPfp98ZLAnFSYCFApfJKMbiXNLwxj", "Czfq3xZZDmsdGdUyrNLtRhGc47cXcZtLG4crryfu44zE"}}, // {"pairs": [...]}
+	{"testdata/dexscreener/pair_by_address.json", []string{"8sLbNZoA1cfnvMJLPfp98ZLAnFSYCFApfJKMbiXNLwxj"}},                                              // {"pair": {...}}
+	{"testdata/dexscreener/token_pairs.json", []string{"8sLbNZoA1cfnvMJLPfp98ZLAnFSYCFApfJKMbiXNLwxj", "6oFWm7KPLfxnwMb3z5xwBoXNSPP3JJyirAPqPSiVcnsp"}},  // [...]
+}
+
+func TestDecodeDexScreenerShapes(t *testing.T) {
+	for _, c := range dexScreenerShapes {
+		t.Run(filepath.Base(c.fixture), func(t *testing.T) {
+			body, err := os.ReadFile(c.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testDexScreener(t, func(w http.ResponseWriter, r *http.Request) { w.Write(body) })
+			pairs, err := fetchPairsByAddress(context.Background(), []string{"8sLbNZoA1cfnvMJLPfp98ZLAnFSYCFApfJKMbiXNLwxj"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range pairs {
+				got = append(got, p.PairAddress)
+				if p.BaseToken.Address == "" || p.PriceNative == "" || p.Liquidity.Usd <= 0 {
+					t.Errorf("%s decoded incompletely: %+v", p.PairAddress, p)
+				}
+			}
+			if !slices.Equal(got, c.want) {
+				t.Errorf("decoded pairs %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	for _, empty := range []string{`{"pairs":null}`, `{"pairs":[]}`, `{"pair":null}`, `{"schemaVersion":"1.0.0"}`, `[]`} {
+		if pairs, err := decodeDexScreenerPairs([]byte(empty)); err != nil || len(pairs) != 0 {
+			t.Errorf("%s: %d pairs, %v, want an empty result", empty, len(pairs), err)
+		}
+	}
+}
+
+// go test -fuzz DecodePairs paperstrat.go paperstrat_test.go. The real payloads above are
+// committed as the corpus in testdata/fuzz/FuzzDecodePairs; these seeds cover the shapes.
+func FuzzDecodePairs(f *testing.F) {
+	for _, seed := range []string{
+		`{"pairs":null}`, `{"pair":{"pairAddress":"P","priceUsd":1e400}}`, `[{"pairAddress":"P","fdv":{}}]`, `[]`, `null`, ``,
+	} {
+		f.Add([]byte(seed))
+	}
+	out := log.Writer()
+	log.SetOutput(io.Discard) // Skipped-pair warnings on every input
+	f.Cleanup(func() { log.SetOutput(out) })
+	f.Fuzz(func(t *testing.T, body []byte) {
+		pairs, err := decodeDexScreenerPairs(body)
+		if err != nil {
+			if pairs != nil {
+				t.Fatalf("returned %d pairs along with error %v", len(pairs), err)
+			}
+			return
+		}
+		for _, p := range pairs {
+			if p.PairAddress == "" {
+				t.Fatalf("kept a pair without an address: %+v", p)
+			}
+			for _, v := range []flexFloat{p.Fdv, p.Liquidity.Usd, p.Liquidity.Base, p.Liquidity.Quote,
+				p.Volume.M5, p.Volume.H1, p.Volume.H6, p.Volume.H24,
+				p.PriceChange.M5, p.PriceChange.H1, p.PriceChange.H6, p.PriceChange.H24} {
+				if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+					t.Fatalf("non-finite number survived decoding: %+v", p)
+				}
+			}
+			// A decoded pair is already in canonical form, so it must survive a round trip
+			encoded, err := json.Marshal(p)
+			if err != nil {
+				t.Fatalf("re-encoding %+v: %v", p, err)
+			}
+			var again Pair
+			if err := json.Unmarshal(encoded, &again); err != nil {
+				t.Fatalf("re-decoding %s: %v", encoded, err)
+			}
+			if !reflect.DeepEqual(p, again) {
+				t.Fatalf("round trip changed the pair:\n%+v\n%+v", p, again)
+			}
+		}
+	})
+}
+
+// --- API Fetching ---
+
+// Points the DexScreener fetchers at a test server running h
+func testDexScreener(t *testing.T, h http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	configured := dexScreenerBaseURL
+	dexScreenerBaseURL = srv.URL
+	t.Cleanup(func() { dexScreenerBaseURL = configured })
+}
+
+func TestFetchCancelledMidRequest(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	testDexScreener(t, func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select { // A server that never answers in time
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-arrived // Cancel once the request is in flight
+			cancel()
+		}()
+		started := time.Now()
+		_, err := fetchDexScreenerPairs(ctx, "SOL")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(started); elapsed > 2*time.Second {
+			t.Errorf("returned %v after cancellation started, want promptly", elapsed)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := fetchPairsByAddress(ctx, []string{"PairA", "PairB"})
+		<-arrived
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestRunScoreExplainsRequestedPairs(t *testing.T) {
+	newTestBot(t)
+	thin := testPair("THIN", 0.002)
+	thin.Liquidity.Usd = flexFloat(minLiquidityUSD / 2)
+	requested := map[string]Pair{"PairGOOD": testPair("GOOD", 0.001), "PairTHIN": thin}
+	testDexScreener(t, func(w http.ResponseWriter, r *http.Request) {
+		var found []Pair
+		for _, addr := range strings.Split(strings.TrimPrefix(r.URL.Path, dexScreenerPairsPath+"/"), ",") {
+			if p, ok := requested[addr]; ok {
+				found = append(found, p)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"pairs": found})
+	})
+	fetchPairs = func(context.Context) ([]Pair, error) { return benchPairs(5, 0, benchSOLPriceUSD), nil }
+
+	var out bytes.Buffer
+	runScore(context.Background(), &out, []string{"PairGOOD", "PairTHIN", "PairGONE"})
+	report := strings.Join(strings.Fields(out.String()), " ") // Column padding aside
+	for _, want := range []string{
+		"GOOD () PairGOOD",
+		"rank 1 of 7", // Scored alongside the five-pair live batch, and best of it
+		"gate: filters pass",
+		"THIN () PairTHIN",
+		"gate: filters FAIL low_liquidity", // Still scored, and flagged
+		"PairGONE not found",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("score report missing %q:\n%s", want, out.String())
+		}
+	}
+	if i, j := strings.Index(report, "PairGOOD"), strings.Index(report, "PairTHIN"); i < 0 || j < i {
+		t.Errorf("pairs not reported in the order requested:\n%s", out.String())
+	}
+}
+
+// --- Jupiter Route Check ---
+
+// Serves Jupiter's /quote and /token/{mint} for a 6-decimal token, quoting fillPrice SOL
+// per token for any BUY size
+func testJupiter(t *testing.T, fillPrice float64) {
+	t.Helper()
+	const decimals = 6
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /token/{mint}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"address":%q,"decimals":%d}`, r.PathValue("mint"), decimals)
+	})
+	mux.HandleFunc("GET /quote", func(w http.ResponseWriter, r *http.Request) {
+		lamports, err := strconv.ParseUint(r.URL.Query().Get("amount"), 10, 64)
+		if err != nil || r.URL.Query().Get("inputMint") != wrappedSOLMint {
+			http.Error(w, `{"error":"unsupported"}`, http.StatusBadRequest)
+			return
+		}
+		out := uint64(float64(lamports) / lamportsPerSOL / fillPrice * math.Pow10(decimals))
+		fmt.Fprintf(w, `{"inAmount":"%d","outAmount":"%d","otherAmountThreshold":"%d","slippageBps":50,"priceImpactPct":"0.001"}`, lamports, out, out*995/1000)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	quoteURL, tokenURL := jupiterQuoteURL, jupiterTokenURL
+	jupiterQuoteURL, jupiterTokenURL = srv.URL+"/quote", srv.URL+"/token"
+	t.Cleanup(func() {
+		jupiterQuoteURL, jupiterTokenURL = quoteURL, tokenURL
+		clear(tokenDecimalsCache)
+	})
+}
+
+func TestJupiterRouteRejectsDivergentPrice(t *testing.T) {
+	const dexPrice = 0.001
+	for _, c := range []struct {
+		name     string
+		offBy    float64 // Jupiter's fill price vs DexScreener's, percent
+		wantFail bool
+	}{
+		{"agrees", 0, false},
+		{"within tolerance", routePriceTolerancePercent / 2, false},
+		{"much dearer", 4 * routePriceTolerancePercent, true},
+		{"much cheaper", -4 * routePriceTolerancePercent, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			testJupiter(t, dexPrice*(1+c.offBy/100))
+			err := checkJupiterRoute(context.Background(), testCandidate("JUP", dexPrice), tradeSizeSOL)
+			if (err != nil) != c.wantFail {
+				t.Errorf("got %v, want failed %t", err, c.wantFail)
+			}
+		})
+	}
+}
+
+// --- Preflight ---
+
+// Runs the check whose name starts with prefix; fails the test if there's none
+func runCheck(t *testing.T, checks []preflightCheck, prefix string) error {
+	t.Helper()
+	for _, c := range checks {
+		if strings.HasPrefix(c.Name, prefix) {
+			_, err := c.Run(context.Background())
+			return err
+		}
+	}
+	t.Fatalf("no %q check", prefix)
+	return nil
+}
+
+func TestPreflightFailures(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		check string
+		stub  func(t *testing.T, dir string)
+	}{
+		{"DexScreener down", "DexScreener fetch", func(t *testing.T, _ string) {
+			testDexScreener(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			})
+		}},
+		{"DexScreener not JSON", "DexScreener fetch", func(t *testing.T, _ string) {
+			testDexScreener(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>captive portal</html>")) })
+		}},
+		{"log directory not writable", "Write access", func(t *testing.T, dir string) {
+			notADir := filepath.Join(dir, "logs")
+			if err := os.WriteFile(notADir, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			useRunLogDir(notADir)
+		}},
+		{"corrupt normalization profile", "Normalization profile", func(t *testing.T, _ string) {
+			if err := os.WriteFile(normalizationProfileFile, []byte(`{"samples":`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"snapshot DB unreachable", "Backtest snapshot database", func(t *testing.T, _ string) {
+			configured := backtestDSN
+			backtestDSN = "postgres://preflight@127.0.0.1:1/none?connect_timeout=2" // Nothing listens on port 1
+			t.Cleanup(func() { backtestDSN = configured })
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := newTestBot(t) // backtesting, so the snapshot DB check is included
+			c.stub(t, dir)
+			if err := runCheck(t, paperPreflightChecks(), c.check); err == nil {
+				t.Errorf("%s check passed", c.check)
+			}
+		})
+	}
+
+	t.Run("healthy", func(t *testing.T) { // The same checks pass without the stubs' faults
+		body, err := os.ReadFile("testdata/dexscreener/search_pairs.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		newTestBot(t)
+		testDexScreener(t, func(w http.ResponseWriter, r *http.Request) { w.Write(body) })
+		if err := os.WriteFile(normalizationProfileFile, []byte(`{"samples":100}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		checks := paperPreflightChecks()
+		for _, check := range []string{"DexScreener fetch", "Write access", "Normalization profile"} {
+			if err := runCheck(t, checks, check); err != nil {
+				t.Errorf("%s check failed: %v", check, err)
+			}
+		}
+	})
+
+	t.Run("Jupiter down", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+		}))
+		t.Cleanup(srv.Close)
+		configured := jupiterQuoteURL
+		jupiterQuoteURL = srv.URL
+		t.Cleanup(func() { jupiterQuoteURL = configured })
+		if err := runCheck(t, []preflightCheck{jupiterPreflightCheck()}, "Jupiter quote API"); err == nil {
+			t.Error("Jupiter quote API check passed")
+		}
+	})
+}
+
+// --- Reconciliation ---
+
+// A candidate in a deep pool, so modeled slippage never aborts its fills
+func testCandidate(symbol string, price float64) TokenInfo {
+	return TokenInfo{
+		PairAddress:      "Pair" + symbol,
+		BaseTokenSymbol:  symbol,
+		BaseTokenAddr:    "Mint" + symbol,
+		QuoteTokenSymbol: "SOL",
+		QuoteTokenAddr:   wrappedSOLMint,
+		PriceNative:      price,
+		LiquidityUSD:     minLiquidityUSD * 1000,
+		Score:            1,
+	}
+}
+
+// Sends the log to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return &buf
+}
+
+func TestReconcileBuyPartialSell(t *testing.T) {
+	newTestBot(t)
+	logs := captureLog(t)
+	ctx := context.Background()
+
+	if !openPosition(ctx, testCandidate("REC", 0.001), 0.001, nil) {
+		t.Fatal("BUY was not booked")
+	}
+	now = func() time.Time { return testStart.Add(time.Minute) }
+	if !sellHolding(ctx, holding.AmountToken*0.4, 0.0013, "partial") || !holding.Active {
+		t.Fatal("partial SELL was not booked")
+	}
+	now = func() time.Time { return testStart.Add(2 * time.Minute) }
+	if !sellHolding(ctx, holding.AmountToken, 0.0009, "close") || holding.Active {
+		t.Fatal("closing SELL was not booked")
+	}
+
+	if diff := checkLedger(); math.Abs(diff) > reconcileToleranceSOL {
+		t.Errorf("running ledger is off by %+.12f SOL", diff)
+	}
+	diff, err := reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(diff) > reconcileToleranceSOL {
+		t.Errorf("trade log replay is off by %+.12f SOL", diff)
+	}
+	if strings.Contains(logs.String(), "RECONCILE MISMATCH") {
+		t.Errorf("reconciliation reported a mismatch:\n%s", logs)
+	}
+	if wallet.TradesMade != 1 || ledger.Bought <= 0 || ledger.Sold <= 0 {
+		t.Errorf("got %d trades, ledger %+v", wallet.TradesMade, ledger)
+	}
+}
+
+// Replaces the trade log with entries, a minute apart from testStart
+func writeTradeLog(t *testing.T, entries []TradeLogEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	for i, e := range entries {
+		e.Timestamp = testStart.Add(time.Duration(i) * time.Minute)
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(tradesLogPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Two positions whose fills interleave in the log, as when two runs share it:
+// A = +0.089 then -0.010 (position +0.079), B = +0.158
+func interleavedTrades() []TradeLogEntry {
+	return []TradeLogEntry{
+		{TradeID: "A", Action: "BUY", SOLAmount: 1.0, FeeSOL: 0.01, TokenAmount: 1000},
+		{TradeID: "B", Action: "BUY", SOLAmount: 2.0, FeeSOL: 0.02, TokenAmount: 500},
+		{TradeID: "A", Action: "SELL", SOLAmount: 0.6, FeeSOL: 0.006, TokenAmount: 500, ProfitLossSOL: 0.089, Partial: true},
+		{TradeID: "B", Action: "SELL", SOLAmount: 2.2, FeeSOL: 0.022, TokenAmount: 500, ProfitLossSOL: 0.158, PositionProfitLossSOL: 0.158},
+		{TradeID: "A", Action: "SELL", SOLAmount: 0.5, FeeSOL: 0.005, TokenAmount: 500, ProfitLossSOL: -0.01, PositionProfitLossSOL: 0.079},
+	}
+}
+
+func TestReconcilePairsFillsByTradeID(t *testing.T) {
+	newTestBot(t)
+	wallet.SOLBalance = wallet.InitialSOL - 3.0 + 3.3 - 0.063 // Bought, sold and fees across both
+	wallet.TotalFeesPaid = 0.063
+
+	for _, c := range []struct {
+		name     string
+		trades   func() []TradeLogEntry
+		mismatch []string // Substrings the RECONCILE MISMATCH lines must contain; none = clean
+	}{
+		{"interleaved", interleavedTrades, nil},
+		{"closing SELLs swapped", func() []TradeLogEntry {
+			trades := interleavedTrades()
+			trades[3].TradeID, trades[4].TradeID = "A", "B" // Each close now sums the other trade's fills
+			return trades
+		}, []string{"trade A closed", "trade B closed"}},
+		{"orphan SELL", func() []TradeLogEntry {
+			return append(interleavedTrades(), TradeLogEntry{TradeID: "ghost", Action: "SELL"})
+		}, []string{"1 SELL(s) without a matching BUY: [ghost]"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			logs := captureLog(t)
+			writeTradeLog(t, c.trades())
+			diff, err := reconcile()
+			if err != nil || math.Abs(diff) > reconcileToleranceSOL {
+				t.Fatalf("balance diff %+.12f, %v", diff, err)
+			}
+			out := logs.String()
+			if len(c.mismatch) == 0 && strings.Contains(out, "RECONCILE MISMATCH") {
+				t.Errorf("reported a mismatch:\n%s", out)
+			}
+			for _, want := range c.mismatch {
+				if !strings.Contains(out, want) {
+					t.Errorf("no %q mismatch reported:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+// --- Scoring ---
+
+const scoringCandidates = 5000 // Above parallelScoringThreshold
+
+// n deterministic candidates with every score input varying, plus repeats so ties occur
+func scoringFixture(n int) []TokenInfo {
+	candidates := make([]TokenInfo, n)
+	for i := range candidates {
+		phase := float64(i % 613)
+		candidates[i] = TokenInfo{
+			PairAddress:    fmt.Sprintf("ScorePair%05d", i),
+			PriceChangeM5:  20 * math.Sin(phase),
+			PriceChangeH1:  60 * math.Cos(phase/7),
+			VolumeM5:       minVolume5mUSD * (1 + float64(i%211)),
+			M5BuySellRatio: float64(i%101) / 100,
+			LiquidityUSD:   minLiquidityUSD * (1 + float64(i%53)),
+		}
+	}
+	return candidates
+}
+
+// Scores a copy of candidates with calculateScores forced down one path
+func scoreWithPool(candidates []TokenInfo, parallel bool) []TokenInfo {
+	poolThreshold := math.MaxInt
+	if parallel {
+		poolThreshold = 2
+	}
+	return scoreCandidates(append([]TokenInfo(nil), candidates...), poolThreshold)
+}
+
+func TestCalculateScoresParallelMatchesSequential(t *testing.T) {
+	candidates := scoringFixture(scoringCandidates)
+	sequential := scoreWithPool(candidates, false)
+	parallel := scoreWithPool(candidates, true)
+	if !reflect.DeepEqual(sequential, parallel) {
+		for i := range sequential {
+			if !reflect.DeepEqual(sequential[i], parallel[i]) {
+				t.Fatalf("candidate %d scored differently:\nsequential %+v\nparallel   %+v", i, sequential[i], parallel[i])
+			}
+		}
+	}
+	sortCandidates(sequential)
+	sortCandidates(parallel)
+	for i := range sequential {
+		if sequential[i].PairAddress != parallel[i].PairAddress {
+			t.Fatalf("order differs at %d: sequential %s, parallel %s", i, sequential[i].PairAddress, parallel[i].PairAddress)
+		}
+	}
+}
+
+// go test -bench CalculateScores -benchmem paperstrat.go paperstrat_test.go
+func BenchmarkCalculateScores(b *testing.B) {
+	candidates := scoringFixture(scoringCandidates)
+	for _, parallel := range []bool{false, true} {
+		b.Run(fmt.Sprintf("parallel=%t", parallel), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scoreWithPool(candidates, parallel)
+			}
+		})
+	}
+}
+
+func TestPumpPenaltyInvertedU(t *testing.T) {
+	const ceiling = 50.0
+	for _, c := range []struct {
+		change, slope, want float64
+	}{
+		{-20, 1, -20}, // Below the ceiling: unchanged, drops included
+		{30, 1, 30},
+		{50, 1, 50}, // The peak
+		{80, 1, 20}, // As far past the ceiling as 20 is below it
+		{100, 1, 0},
+		{80, 0, 50},  // Flat cap
+		{80, 2, -10}, // Falls off twice as fast
+	} {
+		if got := pumpPenalized(c.change, ceiling, c.slope); got != c.want {
+			t.Errorf("pumpPenalized(%v, %v, slope %v) = %v, want %v", c.change, ceiling, c.slope, got, c.want)
+		}
+	}
+	if !pumpExhaustionPenalty && exhaustionAdjusted(500, ceiling) != 500 {
+		t.Error("exhaustionAdjusted changed a price change with the penalty off")
+	}
+}
+
+func TestProfileSeedsEarlyCycles(t *testing.T) {
+	newTestBot(t)
+	path := filepath.Join(t.TempDir(), "profile.json")
+	profile := `{"samples": 1000, "window": "24h0m0s", "metrics": {
+		"priceChangeM5": {"p05": -10, "p95": 50},
+		"priceChangeH1": {"p05": -20, "p95": 200},
+		"volumeM5": {"p05": 0, "p95": 100000},
+		"buySellRatioM5": {"p05": 0.3, "p95": 0.8},
+		"liquidityUsd": {"p05": 5000, "p95": 1000000}}}`
+	if err := os.WriteFile(path, []byte(profile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	normProfile = loadNormalizationProfile(path)
+	if normProfile == nil {
+		t.Fatal("profile didn't load")
+	}
+
+	weak := func() []TokenInfo { // A uniformly weak batch; batch normalization would still rate one a 1
+		return []TokenInfo{
+			{PairAddress: "Weaker", PriceChangeM5: 1, PriceChangeH1: 1, VolumeM5: 100, M5BuySellRatio: 0.5, LiquidityUSD: 10_000},
+			{PairAddress: "Stronger", PriceChangeM5: 2, PriceChangeH1: 2, VolumeM5: 200, M5BuySellRatio: 0.55, LiquidityUSD: 12_000},
+		}
+	}
+	scanCycles = 1
+	seeded := calculateScores(weak())
+	if best := seeded[1].Score; best <= seeded[0].Score || best > 0.5 {
+		t.Errorf("seeded scores %.4f, %.4f; want the stronger pair ahead but scored against the profile, well under 0.5",
+			seeded[0].Score, seeded[1].Score)
+	}
+	if lone := calculateScores(weak()[1:]); lone[0].Score != seeded[1].Score {
+		t.Errorf("a lone candidate scored %.4f while seeding, want %.4f (the profile gives it a range)", lone[0].Score, seeded[1].Score)
+	}
+	hot := weak()
+	hot[1].VolumeM5 = 1e9 // Beyond the profile's p95
+	if c := calculateScores(hot)[1]; c.NormM5Volume != 1 {
+		t.Errorf("volume above the profile normalized to %.4f, want clamped to 1", c.NormM5Volume)
+	}
+
+	scanCycles = profileSeedCycles + 1
+	if live := calculateScores(weak()); math.Abs(live[1].Score-1) > 1e-9 {
+		t.Errorf("after %d cycles the stronger pair scored %.4f, want 1 (normalized against its batch)", profileSeedCycles, live[1].Score)
+	}
+}
+
+func TestBlendedMomentumConfidenceRamp(t *testing.T) {
+	const apiChange = 50.0
+	series := func(n int) []pairSample {
+		samples := make([]pairSample, n)
+		for i := range samples {
+			samples[i] = pairSample{Time: testStart.Add(time.Duration(i) * 30 * time.Second), PriceNative: 1 + 0.01*float64(i)}
+		}
+		return samples
+	}
+	for _, tc := range []struct {
+		samples int
+		weight  float64
+	}{
+		{1, 0}, // No local measurement yet: the API value alone
+		{momentumMinLocalSamples, 0},
+		{(momentumMinLocalSamples + momentumFullConfidenceSamples) / 2, momentumMaxLocalWeight / 2},
+		{momentumFullConfidenceSamples, momentumMaxLocalWeight},
+	} {
+		blended, local, weight := blendedMomentumM5(apiChange, series(tc.samples))
+		if math.Abs(weight-tc.weight) > 1e-9 {
+			t.Errorf("%d samples: local weight %g, want %g", tc.samples, weight, tc.weight)
+		}
+		if want := (1-weight)*apiChange + weight*local; math.Abs(blended-want) > 1e-9 {
+			t.Errorf("%d samples: blended %g, want %g (api %g, local %g)", tc.samples, blended, want, apiChange, local)
+		}
+	}
+	// At full confidence the score runs on what we measured: +9% over ten 30s samples
+	if blended, _, _ := blendedMomentumM5(apiChange, series(momentumFullConfidenceSamples)); math.Abs(blended-9) > 1e-9 {
+		t.Errorf("full-confidence blend %g, want the local 9%%", blended)
+	}
+}
+
+func TestScoreBreakdownSumsToScore(t *testing.T) {
+	newTestBot(t)
+	var candidates []TokenInfo
+	for _, p := range benchPairs(20, 3, benchSOLPriceUSD) {
+		candidates = append(candidates, tokenInfoFromPair(p))
+	}
+	for _, c := range calculateScores(candidates) {
+		b := scoreBreakdown(c)
+		if b == nil {
+			if c.Score != 0 {
+				t.Errorf("%s scored %.4f but has no breakdown", c.BaseTokenSymbol, c.Score)
+			}
+			continue
+		}
+		parts := []ScoreComponent{b.M5Change, b.H1Change, b.M5Volume, b.M5BuySellRatio, b.Liquidity}
+		sum, top := 0.0, 0.0
+		for _, p := range parts {
+			sum += p.Contribution
+			top = math.Max(top, p.Contribution)
+		}
+		if math.Abs(sum-c.Score) > 1e-12 || b.Score != c.Score {
+			t.Errorf("%s: contributions sum to %.6f, score %.6f (breakdown says %.6f)", c.BaseTokenSymbol, sum, c.Score, b.Score)
+		}
+		byName := map[string]ScoreComponent{"m5Change": b.M5Change, "h1Change": b.H1Change, "m5Volume": b.M5Volume, "m5BuySellRatio": b.M5BuySellRatio, "liquidity": b.Liquidity}
+		if byName[b.Dominant].Contribution != top {
+			t.Errorf("%s: dominant %q contributes %.4f, but the largest part is %.4f", c.BaseTokenSymbol, b.Dominant, byName[b.Dominant].Contribution, top)
+		}
+	}
+	if scoreBreakdown(TokenInfo{}) != nil {
+		t.Error("an unscored candidate got a breakdown")
+	}
+}
+
+func TestReferencePairsAnchorButNeverRank(t *testing.T) {
+	var candidates []TokenInfo
+	for _, p := range benchPairs(5, 0, benchSOLPriceUSD) {
+		candidates = append(candidates, tokenInfoFromPair(p))
+	}
+	whale := testPair("WHALE", 0.001) // Would top every component if ranked
+	whale.Volume.M5, whale.Liquidity.Usd, whale.PriceChange.H1 = minVolume5mUSD*1000, minLiquidityUSD*1e5, 500
+	ref := tokenInfoFromPair(whale)
+
+	plain := calculateScores(slices.Clone(candidates))
+	anchored := scoreWithReferences(slices.Clone(candidates), []TokenInfo{ref})
+	if len(anchored) != len(candidates) {
+		t.Fatalf("%d scored, want the %d candidates without the reference", len(anchored), len(candidates))
+	}
+	for i := range anchored {
+		if anchored[i].PairAddress != candidates[i].PairAddress {
+			t.Errorf("scored[%d] is %s, want %s", i, anchored[i].PairAddress, candidates[i].PairAddress)
+		}
+		if anchored[i].Score >= plain[i].Score {
+			t.Errorf("%s scores %.4f anchored, %.4f alone; the reference's range should pull it down",
+				anchored[i].BaseTokenSymbol, anchored[i].Score, plain[i].Score)
+		}
+	}
+
+	newTestBot(t)
+	saved := referencePairs
+	referencePairs = []string{whale.PairAddress}
+	t.Cleanup(func() { referencePairs = saved })
+	scanAt(testStart, append(benchPairs(5, 0, benchSOLPriceUSD), whale))
+	for _, c := range scanState.Status().Candidates {
+		if c.PairAddress == whale.PairAddress {
+			t.Fatal("the reference pair was ranked as a candidate")
+		}
+	}
+	if holding.Active && holding.PairAddress == whale.PairAddress {
+		t.Error("bought the reference pair")
+	}
+}
+
+// --- Exits ---
+
+// A pair that passes the filters, for the token testCandidate(symbol, ...) opened
+func testPair(symbol string, price float64) Pair {
+	p := benchPairs(1, 0, benchSOLPriceUSD)[0]
+	p.PairAddress = "Pair" + symbol
+	p.BaseToken = Token{Address: "Mint" + symbol, Symbol: symbol}
+	p.PriceNative = flexString(strconv.FormatFloat(price, 'g', -1, 64))
+	p.PriceUsd = flexString(strconv.FormatFloat(price*benchSOLPriceUSD, 'g', -1, 64))
+	p.Liquidity.Usd = minLiquidityUSD * 1000
+	return p
+}
+
+// Opens a position in symbol at price at testStart
+func openTestPosition(t *testing.T, symbol string, price float64) {
+	t.Helper()
+	now = func() time.Time { return testStart }
+	if !openPosition(context.Background(), testCandidate(symbol, price), price, nil) {
+		t.Fatalf("BUY %s was not booked", symbol)
+	}
+}
+
+// Runs with a 60s minimum hold before profit exits
+func withProfitExitMinHold(t *testing.T) {
+	minHoldBeforeProfitExit = time.Minute
+	t.Cleanup(func() { minHoldBeforeProfitExit = defaultMinHoldBeforeProfitExit })
+}
+
+// This run's logged trades, oldest first
+func loggedTrades(t *testing.T, dir string) []TradeLogEntry {
+	t.Helper()
+	entries, err := readRunLog[TradeLogEntry](dir, tradesLogFile, tradesLogFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestUnrealizedPLAndLevelsAtAMarkPrice(t *testing.T) {
+	newTestBot(t)
+	h := CurrentHolding{
+		Active:             true,
+		EntryPriceNative:   0.001,
+		PeakPriceNative:    0.001,
+		AmountToken:        1000,
+		InitialAmountToken: 1000,
+		CostBasisSOL:       1.003, // 1 SOL plus the 0.3% buy fee
+		EntryLiquidityUSD:  100_000,
+		PeakLiquidityUSD:   100_000,
+	}
+	const mark = 0.0011 // +10%
+
+	// 1000 × 0.0011 × (1 - 0.3%) = 1.0967 SOL back for 1.003 in
+	sol, percent := unrealizedPL(h, mark)
+	if math.Abs(sol-0.0937) > 1e-9 || math.Abs(percent-0.0937/1.003*100) > 1e-9 {
+		t.Errorf("unrealized P/L %g SOL (%g%%), want 0.0937 SOL (%.4f%%)", sol, percent, 0.0937/1.003*100)
+	}
+	half := h
+	half.AmountToken = 500 // After a 50% take-profit: half the tokens carry half the cost
+	if halfSOL, halfPercent := unrealizedPL(half, mark); math.Abs(halfSOL-sol/2) > 1e-9 || math.Abs(halfPercent-percent) > 1e-9 {
+		t.Errorf("half position P/L %g SOL (%g%%), want %g SOL at the same %g%%", halfSOL, halfPercent, sol/2, percent)
+	}
+
+	levels := positionLevels(h, mark, 80_000)
+	type level struct {
+		name      string
+		value     float64
+		triggered bool
+	}
+	want := []level{
+		{"Hard stop", 0.001 * (1 - hardStopLossPercent), false},
+		{"Trailing stop", mark * (1 - trailingStopLossPercent), false}, // Trails the mark, now the peak
+		{"Take profit 1/1", 0.001 * takeProfitThreshold, true},
+		{"Liquidity drop", 100_000 * (1 - liquidityDropPercent), false},
+	}
+	if len(levels) != len(want) {
+		t.Fatalf("levels %+v, want %d of them", levels, len(want))
+	}
+	for i, w := range want {
+		l := levels[i]
+		current := mark
+		if l.Unit == "USD" {
+			current = 80_000
+		}
+		if l.Name != w.name || math.Abs(l.Value-w.value) > 1e-12 || l.Triggered != w.triggered ||
+			math.Abs(l.DistancePercent-(w.value/current-1)*100) > 1e-9 {
+			t.Errorf("level %d = %+v, want %s at %g (triggered %t)", i, l, w.name, w.value, w.triggered)
+		}
+	}
+}
+
+func TestVolatilityWidensTakeProfit(t *testing.T) {
+	newTestBot(t)
+	swinging := func(swing float64) []pairSample {
+		samples := make([]pairSample, volatilityWindowSamples)
+		for i := range samples {
+			samples[i] = pairSample{PriceNative: 1 + swing*float64(i%2)}
+		}
+		return samples
+	}
+	h := CurrentHolding{Active: true, EntryPriceNative: 1, RungsFilled: make([]bool, len(takeProfitLadder))}
+	price := takeProfitThreshold + 0.01 // Past the static target
+
+	if scale, _, ok := exitVolatilityScale(swinging(0.03)); ok || scale != 1 {
+		t.Errorf("scaled exits off: scale %g (ok %t), want 1", scale, ok)
+	}
+	volatilityScaledExits = true
+	t.Cleanup(func() { volatilityScaledExits = defaultVolatilityScaledExits })
+
+	quiet, _, _ := exitVolatilityScale(swinging(0.002))
+	volatile, vol, ok := exitVolatilityScale(swinging(0.02))
+	if !ok || quiet != volatilityScaleMin || math.Abs(volatile-vol/volatilityReferencePercent) > 1e-12 || volatile <= 1 {
+		t.Fatalf("scales quiet %g, volatile %g (vol %g%%); want the floor and vol/reference above 1", quiet, volatile, vol)
+	}
+	if due := dueTakeProfitRungs(h, price, 1); due != 1 {
+		t.Errorf("static target: %d rungs due at %g, want 1", due, price)
+	}
+	if due := dueTakeProfitRungs(h, price, quiet); due != 1 {
+		t.Errorf("quiet pair: %d rungs due at %g, want 1 (the target tightens)", due, price)
+	}
+	if due := dueTakeProfitRungs(h, price, volatile); due != 0 {
+		t.Errorf("volatile pair: %d rungs due at %g, want 0 (the target widens)", due, price)
+	}
+	if due := dueTakeProfitRungs(h, 1+(takeProfitThreshold-1)*volatile+0.001, volatile); due != 1 {
+		t.Errorf("volatile pair: rung not due past its widened target")
+	}
+}
+
+func TestRangeTrailFollowsAverageMove(t *testing.T) {
+	// Samples stepping by the given per-cycle moves, alternating up and down
+	series := func(n int, move float64) []pairSample {
+		samples := make([]pairSample, n)
+		price := 1.0
+		for i := range samples {
+			samples[i] = pairSample{Time: testStart.Add(time.Duration(i) * refreshInterval), PriceNative: price}
+			if i%2 == 0 {
+				price *= 1 + move
+			} else {
+				price *= 1 - move
+			}
+		}
+		return samples
+	}
+	t.Cleanup(func() { atrTrailingStop = defaultATRTrailingStop })
+
+	atrTrailingStop = false
+	if _, ok := rangeTrailPercent(series(atrLookbackSamples, 0.02)); ok {
+		t.Errorf("range trail applied while off")
+	}
+
+	atrTrailingStop = true
+	for _, c := range []struct {
+		name   string
+		series []pairSample
+		want   float64
+		wantOK bool
+	}{
+		{"2% swings", series(atrLookbackSamples, 0.02), 0.02 * atrTrailMultiplier, true},
+		{"older samples ignored", append(series(5, 0.5), series(atrLookbackSamples, 0.02)...), 0.02 * atrTrailMultiplier, true},
+		{"flat: clamped to the minimum", series(atrLookbackSamples, 0), atrTrailMinPercent, true},
+		{"wild: clamped to the maximum", series(atrLookbackSamples, 0.2), atrTrailMaxPercent, true},
+		{"too little history", series(atrLookbackSamples-1, 0.02), 0, false},
+	} {
+		got, ok := rangeTrailPercent(c.series)
+		if ok != c.wantOK || math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: trail %.4f (ok %t), want %.4f (ok %t)", c.name, got, ok, c.want, c.wantOK)
+		}
+	}
+
+	bad := series(atrLookbackSamples, 0.02)
+	bad[3].PriceNative = 0
+	if _, ok := averageRangeFraction(bad, atrLookbackSamples); ok {
+		t.Errorf("average range computed across a zero price")
+	}
+}
+
+func TestTrailingStopWaitsForArm(t *testing.T) {
+	// Peak +1%, then a dip through the 3% trail that stays above the hard stop
+	dip := 1.01 * (1 - trailingStopLossPercent) * 0.99
+	for _, arm := range []float64{0, 0.05} {
+		dir := newTestBot(t)
+		armed := compiledProfile()
+		armed.TrailingStopArmPercent = arm
+		strategyProfiles, activeProfile = map[string]StrategyProfile{"armed": armed}, "armed"
+		openTestPosition(t, "ARM", 1)
+		if got, want := trailingStopArmPrice(holding), 1+arm; math.Abs(got-want) > 1e-12 {
+			t.Fatalf("arm %g: trailingStopArmPrice = %g, want %g", arm, got, want)
+		}
+		scanAt(testStart.Add(refreshInterval), []Pair{testPair("ARM", 1.01)})
+		scanAt(testStart.Add(2*refreshInterval), []Pair{testPair("ARM", dip)})
+		trades := loggedTrades(t, dir)
+		if arm == 0 {
+			if holding.Active || len(trades) != 2 || !strings.HasPrefix(trades[1].Reason, "Trailing Stop Loss") {
+				t.Errorf("arm off: want a Trailing Stop Loss at %g, got active %t, trades %+v", dip, holding.Active, trades)
+			}
+			continue
+		}
+		if !holding.Active || len(trades) != 1 {
+			t.Fatalf("arm %g: trailing stop fired before the peak reached the arm price (trades %+v)", arm, trades)
+		}
+
+		// Still unarmed, so a deeper drop is the hard stop's
+		scanAt(testStart.Add(3*refreshInterval), []Pair{testPair("ARM", 1-hardStopLossPercent-0.01)})
+		trades = loggedTrades(t, dir)
+		if holding.Active || len(trades) != 2 || !strings.HasPrefix(trades[1].Reason, "Hard Stop Loss") {
+			t.Errorf("arm %g: want a Hard Stop Loss below an unarmed trail, got active %t, trades %+v", arm, holding.Active, trades)
+		}
+	}
+}
+
+func TestHardStopBypassesMinHold(t *testing.T) {
+	dir := newTestBot(t)
+	withProfitExitMinHold(t)
+	openTestPosition(t, "HARD", 1)
+
+	scanAt(testStart.Add(10*time.Second), []Pair{testPair("HARD", 1-hardStopLossPercent-0.02)})
+	trades := loggedTrades(t, dir)
+	if holding.Active || len(trades) != 2 || !strings.HasPrefix(trades[1].Reason, "Hard Stop Loss") {
+		t.Fatalf("hard stop did not fire 10s into a %v minimum hold (active %t, trades %+v)", minHoldBeforeProfitExit, holding.Active, trades)
+	}
+}
+
+func TestLiquidityTrailExitsAsLiquidityBleeds(t *testing.T) {
+	// Liquidity doubles after entry, then gives back a quarter of its peak while the price
+	// holds: still above the entry-based liquidity drop, but through a 20% trail
+	entryLiquidity := testCandidate("LTR", 1).LiquidityUSD
+	series := func() [][]Pair {
+		var cycles [][]Pair
+		for _, liquidity := range []float64{2 * entryLiquidity, 1.5 * entryLiquidity} {
+			p := testPair("LTR", 1)
+			p.Liquidity.Usd = flexFloat(liquidity)
+			p.PriceChange.M5 = 5 // Momentum intact
+			cycles = append(cycles, []Pair{p})
+		}
+		return cycles
+	}
+
+	for _, trail := range []float64{0, 0.2} {
+		dir := newTestBot(t)
+		liquidityTrailPercent = trail
+		t.Cleanup(func() { liquidityTrailPercent = defaultLiquidityTrailPercent })
+		openTestPosition(t, "LTR", 1)
+		for i, pairs := range series() {
+			scanAt(testStart.Add(time.Duration(i+1)*refreshInterval), pairs)
+		}
+		trades := loggedTrades(t, dir)
+		switch {
+		case trail == 0 && (!holding.Active || len(trades) != 1):
+			t.Errorf("trail off: position closed on a liquidity pullback above the entry drop (trades %+v)", trades)
+		case trail > 0 && (holding.Active || len(trades) != 2 || !strings.HasPrefix(trades[1].Reason, "Liquidity Trail")):
+			t.Errorf("trail %g: want a Liquidity Trail exit, got active %t, trades %+v", trail, holding.Active, trades)
+		}
+	}
+}
+
+func TestTakeProfitWaitsForMinHold(t *testing.T) {
+	newTestBot(t)
+	withProfitExitMinHold(t)
+	openTestPosition(t, "TP", 1)
+	bought := holding.AmountToken
+	up := []Pair{testPair("TP", takeProfitThreshold+0.1)}
+
+	scanAt(testStart.Add(10*time.Second), up)
+	if !holding.Active || holding.AmountToken != bought {
+		t.Fatalf("take-profit sold 10s into a %v minimum hold (active %t, %v of %v tokens left)",
+			minHoldBeforeProfitExit, holding.Active, holding.AmountToken, bought)
+	}
+	scanAt(testStart.Add(minHoldBeforeProfitExit+10*time.Second), up)
+	if holding.Active && holding.AmountToken == bought {
+		t.Fatal("take-profit did not fire once the minimum hold had passed")
+	}
+}
+
+// Runs with a 100 bps slippage limit and a SOL/USD reference to model slippage against
+func withSlippageLimit(t *testing.T) {
+	maxSlippageBps = 100
+	t.Cleanup(func() { maxSlippageBps = defaultMaxSlippageBps })
+	solUSDHistory = []solPriceSample{{Time: testStart, PriceUSD: benchSOLPriceUSD}}
+}
+
+// Liquidity (USD) of a pool in which swapping sizeSOL slips by 10x maxSlippageBps
+func thinPoolLiquidityUSD(sizeSOL float64) float64 {
+	const slip = 0.1 // 1000 bps
+	return 2 * benchSOLPriceUSD * sizeSOL * (1 - slip) / slip
+}
+
+func TestSlippageAbortsEntry(t *testing.T) {
+	dir := newTestBot(t)
+	withSlippageLimit(t)
+	balance := wallet.SOLBalance
+	thin := testCandidate("THIN", 0.001)
+	thin.LiquidityUSD = thinPoolLiquidityUSD(tradeSizeSOL)
+
+	if openPosition(context.Background(), thin, thin.PriceNative, nil) {
+		t.Fatal("BUY filled in a pool that slips past the limit")
+	}
+	trades := loggedTrades(t, dir)
+	if holding.Active || wallet.SOLBalance != balance || wallet.AbortedEntries != 1 {
+		t.Errorf("holding %t, balance %v (was %v), %d aborted entries: want no position change and one abort",
+			holding.Active, wallet.SOLBalance, balance, wallet.AbortedEntries)
+	}
+	if len(trades) != 1 || trades[0].Action != "BUY_ABORTED" || trades[0].FeeSOL != 0 || trades[0].SlippageBps <= maxSlippageBps {
+		t.Fatalf("logged %+v, want one fee-less BUY_ABORTED above the limit", trades)
+	}
+
+	openTestPosition(t, "DEEP", 0.001) // The limit passes a deep pool
+}
+
+func TestSlippageAbortsExit(t *testing.T) {
+	dir := newTestBot(t)
+	withSlippageLimit(t)
+	openTestPosition(t, "COLLAPSE", 0.001)
+	bought, balance := holding.AmountToken, wallet.SOLBalance
+	stop := 0.001 * (1 - hardStopLossPercent - 0.02)
+	holding.LastLiquidityUSD = thinPoolLiquidityUSD(bought * stop) // The pool collapsed along with the price
+
+	if sellHolding(context.Background(), bought, stop, "Hard Stop Loss") {
+		t.Fatal("stop filled in a pool that slips past the limit")
+	}
+	trades := loggedTrades(t, dir)
+	if !holding.Active || holding.AmountToken != bought || wallet.SOLBalance != balance || wallet.AbortedExits != 1 {
+		t.Errorf("holding %t with %v of %v tokens, balance %v (was %v), %d aborted exits: want the position kept and one abort",
+			holding.Active, holding.AmountToken, bought, wallet.SOLBalance, balance, wallet.AbortedExits)
+	}
+	if len(trades) != 2 || trades[1].Action != "SELL_ABORTED" || trades[1].FeeSOL != 0 || trades[1].Reason != "Hard Stop Loss" {
+		t.Fatalf("logged %+v, want the BUY then one fee-less SELL_ABORTED", trades)
+	}
+
+	holding.LastLiquidityUSD = minLiquidityUSD * 1000 // Liquidity back: the retry fills
+	if !sellHolding(context.Background(), bought, stop, "Hard Stop Loss") || holding.Active {
+		t.Error("exit still not filled once the pool could take it")
+	}
+}
+
+func TestBreakEvenPriceCoversBothFees(t *testing.T) {
+	cfg := resolveConfig()
+	cfg.SimulatedFeePercent, cfg.FixedFeeSOL = 0.01, 0.002
+	// Bought 1000 tokens for 1.004 SOL all in, then sold 600 of them
+	h := CurrentHolding{Active: true, CostBasisSOL: 1.004, InitialAmountToken: 1000, AmountToken: 400}
+
+	// The remaining 400 cost 0.4016 SOL. Selling them at p nets 400p*0.99 - 0.002, so
+	// p = (0.4016 + 0.002) / 0.99 / 400 = 0.00101919...
+	const want = 0.4036 / 0.99 / 400
+	got := breakEvenPrice(h, cfg)
+	if math.Abs(got-want) > 1e-15 {
+		t.Fatalf("break-even %.12f, want %.12f", got, want)
+	}
+	if net := 400*got*(1-cfg.SimulatedFeePercent) - cfg.FixedFeeSOL; math.Abs(net-0.4016) > 1e-12 {
+		t.Errorf("selling the rest at break-even nets %.12f SOL, want the 0.4016 it cost", net)
+	}
+	if got := breakEvenPrice(CurrentHolding{}, cfg); got != 0 {
+		t.Errorf("break-even with no position = %v, want 0", got)
+	}
+}
+
+// --- Adaptive Threshold ---
+
+// Closes n trades with the given outcome, as bookSell counts them
+func closeTrades(n int, won bool) {
+	for range n {
+		wallet.TradesMade++
+		if won {
+			wallet.ProfitableTrades++
+		}
+		recordTradeOutcome(won)
+	}
+}
+
+func TestAdaptiveThresholdFollowsStreaks(t *testing.T) {
+	adaptiveEntryThreshold = true
+	t.Cleanup(func() { adaptiveEntryThreshold = defaultAdaptiveEntryThreshold })
+	for _, c := range []struct {
+		name     string
+		base     float64 // The profile's minScoreToEnter
+		won      bool
+		want     func(got float64) bool
+		wantDesc string
+	}{
+		{"losing raises", minScoreToEnter, false, func(got float64) bool { return got > minScoreToEnter && got <= adaptiveMaxScore }, "above minScoreToEnter"},
+		{"winning lowers", minScoreToEnter, true, func(got float64) bool { return got < minScoreToEnter && got >= adaptiveMinScore }, "below minScoreToEnter"},
+		{"losing stops at the max", adaptiveMaxScore - adaptiveMaxShift/2, false, func(got float64) bool { return got == adaptiveMaxScore }, "adaptiveMaxScore"},
+		{"winning stops at the min", adaptiveMinScore + adaptiveMaxShift/2, true, func(got float64) bool { return got == adaptiveMinScore }, "adaptiveMinScore"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			newTestBot(t)
+			strategyProfiles = map[string]StrategyProfile{defaultProfileName: {MinScoreToEnter: c.base}}
+			effectiveMinScore = c.base
+			previous := entryThreshold()
+			for i := range adaptiveWindowTrades {
+				closeTrades(1, c.won)
+				got := entryThreshold()
+				if got < adaptiveMinScore || got > adaptiveMaxScore {
+					t.Fatalf("after %d trades: threshold %.4f outside [%.2f, %.2f]", i+1, got, adaptiveMinScore, adaptiveMaxScore)
+				}
+				if c.won && got > previous || !c.won && got < previous {
+					t.Fatalf("after %d trades: threshold moved %.4f -> %.4f against the streak", i+1, previous, got)
+				}
+				previous = got
+			}
+			if !c.want(previous) {
+				t.Errorf("threshold %.4f after a %d-trade streak from %.2f, want %s", previous, adaptiveWindowTrades, c.base, c.wantDesc)
+			}
+		})
+	}
+
+	t.Run("mixed record recovers", func(t *testing.T) {
+		newTestBot(t)
+		closeTrades(adaptiveWindowTrades, false)
+		raised := entryThreshold()
+		closeTrades(adaptiveWindowTrades, true)
+		if got := entryThreshold(); got >= raised {
+			t.Errorf("threshold %.4f after wins following losses, want below the %.4f the losses left", got, raised)
+		}
+	})
+}
+
+// --- Sizing ---
+
+func TestRiskBasedSizingShrinksWithWiderStop(t *testing.T) {
+	newTestBot(t)
+	riskBasedSizing = true
+	t.Cleanup(func() { riskBasedSizing = defaultRiskBasedSizing })
+
+	prev := math.Inf(1)
+	for _, stop := range []float64{0.05, 0.10, 0.20, 0.40} {
+		size := positionSizeSOL(stop)
+		if size >= prev {
+			t.Errorf("%.0f%% stop: size %.4f SOL, want smaller than the narrower stop's %.4f", stop*100, size, prev)
+		}
+		if lost := size * stop; math.Abs(lost-riskPerTradeSOL) > 1e-9 {
+			t.Errorf("%.0f%% stop: hitting it loses %.4f SOL, want the %.4f budget", stop*100, lost, riskPerTradeSOL)
+		}
+		prev = size
+	}
+
+	if size := positionSizeSOL(riskPerTradeSOL / maxPositionSizeSOL / 10); size != maxPositionSizeSOL {
+		t.Errorf("tight stop: size %.4f SOL, want the %.4f cap", size, maxPositionSizeSOL)
+	}
+	wallet.SOLBalance = 0.5
+	if size, want := positionSizeSOL(0.05), (0.5-fixedFeeSOL)/(1+simulatedFeePercent); math.Abs(size-want) > 1e-9 {
+		t.Errorf("short balance: size %.4f SOL, want what it covers after fees, %.4f", size, want)
+	}
+}
+
+func TestFixedFeeDragsSmallTrades(t *testing.T) {
+	// Round-trip loss at a flat price, in percent of cost, for a 1 SOL and a 0.1 SOL entry
+	// (risk-based sizing: the same risk budget over a 10x wider stop)
+	roundTripDrag := func(fixed float64) (large, small float64) {
+		for _, stop := range []float64{riskPerTradeSOL, riskPerTradeSOL * 10} {
+			newTestBot(t)
+			riskBasedSizing, fixedFeeSOL = true, fixed
+			t.Cleanup(func() { riskBasedSizing, fixedFeeSOL = defaultRiskBasedSizing, defaultFixedFeeSOL })
+			p := compiledProfile()
+			p.HardStopLossPercent = stop
+			strategyProfiles, activeProfile = map[string]StrategyProfile{"sized": p}, "sized"
+			openTestPosition(t, "FEE", 1)
+
+			size := riskPerTradeSOL / stop
+			cost := size*(1+simulatedFeePercent) + fixed
+			want := (size*(1-simulatedFeePercent) - fixed - cost) / cost * 100
+			_, drag := unrealizedPL(holding, 1)
+			if math.Abs(drag-want) > 1e-9 {
+				t.Errorf("fixed fee %g, %g SOL entry: flat round trip %.4f%%, want %.4f%%", fixed, size, drag, want)
+			}
+			if stop == riskPerTradeSOL {
+				large = drag
+			} else {
+				small = drag
+			}
+		}
+		return large, small
+	}
+
+	if large, small := roundTripDrag(0); math.Abs(large-small) > 1e-9 {
+		t.Errorf("percentage fee only: drag %.4f%% at 1 SOL vs %.4f%% at 0.1 SOL, want equal", large, small)
+	}
+	large, small := roundTripDrag(0.001)
+	// Two fixed fees are 0.2% of a 1 SOL round trip but 2% of a 0.1 SOL one
+	if gap := large - small; math.Abs(gap-1.8) > 0.05 {
+		t.Errorf("0.001 SOL fixed fee: drag %.4f%% at 1 SOL, %.4f%% at 0.1 SOL; want the small trade ~1.8 points worse", large, small)
+	}
+}
+
+// --- Correlation Guard ---
+
+func TestCorrelatedExitBlocksTwinAllowsOthers(t *testing.T) {
+	newTestBot(t)
+	monitorOnly = true // Build history without buying
+	t.Cleanup(func() { monitorOnly = false })
+
+	const cycles = correlationWindowSamples + 2
+	for i := range cycles {
+		wave := math.Sin(float64(i) * 1.3)
+		pairs := []Pair{
+			testPair("DUMP", 1+0.2*wave),
+			testPair("TWIN", 2+0.3*wave+0.01*float64(i%2)),    // Moves with DUMP
+			testPair("ALONE", 1+0.2*math.Cos(float64(i)*2.9)), // Its own path
+		}
+		if i >= cycles-2 {
+			pairs = append(pairs, testPair("NEW", 1+0.2*wave)) // Listed two cycles ago
+		}
+		scanAt(testStart.Add(time.Duration(i)*refreshInterval), pairs)
+	}
+	recordExit(CurrentHolding{PairAddress: "PairDUMP", BaseTokenSymbol: "DUMP"}, 1, "Trailing Stop Loss")
+
+	for _, c := range []struct {
+		symbol  string
+		blocked bool
+	}{
+		{"TWIN", true},
+		{"ALONE", false},
+		{"NEW", false}, // Too little history to judge
+		{"DUMP", false},
+	} {
+		exit, corr, blocked := correlatedExit(testCandidate(c.symbol, 1), 0.8)
+		if blocked != c.blocked {
+			t.Errorf("%s: blocked = %t (correlation %.2f with %q), want %t", c.symbol, blocked, corr, exit.Symbol, c.blocked)
+		}
+	}
+	if _, _, blocked := correlatedExit(testCandidate("TWIN", 1), 0); blocked {
+		t.Error("guard blocked with the limit off")
+	}
+
+	now = func() time.Time { return testStart.Add(cycles*refreshInterval + correlationLookback) }
+	if _, _, blocked := correlatedExit(testCandidate("TWIN", 1), 0.8); blocked {
+		t.Errorf("TWIN still blocked %v after DUMP's exit", correlationLookback)
+	}
+}
+
+func TestRecentExitsPrunedWithGuardOff(t *testing.T) {
+	newTestBot(t)
+	for i := range 100 { // An exit every lookback, for as long as the process runs
+		at := testStart.Add(time.Duration(i) * correlationLookback)
+		now = func() time.Time { return at }
+		recordExit(CurrentHolding{PairAddress: "PairA", BaseTokenSymbol: "A"}, 1, "Hard Stop Loss")
+	}
+	if len(recentExits) > 2 {
+		t.Errorf("%d exits kept with the guard off, want only those within %v", len(recentExits), correlationLookback)
+	}
+}
+
+// --- Re-entry After Profit ---
+
+func TestProfitReentry(t *testing.T) {
+	const window = 15 * time.Minute
+	cases := []struct {
+		name   string
+		reason string
+		prices []float64 // Cycles after the exit at 1.10; re-entry is judged on the last
+		want   bool
+	}{
+		{"continuing winner", "Take Profit Rung 1/1 (+10.0%)", []float64{1.15, 1.20}, true},
+		{"reversing", "Take Profit Rung 1/1 (+10.0%)", []float64{1.15, 1.08}, false},
+		{"below an earlier high", "Take Profit Rung 1/1 (+10.0%)", []float64{1.25, 1.20}, false},
+		{"stopped out", "Trailing Stop Loss (< 1.05 SOL)", []float64{1.15, 1.20}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			newTestBot(t)
+			monitorOnly = true // Samples only; profitReentry is the decision under test
+			t.Cleanup(func() { monitorOnly = false })
+			recordExit(CurrentHolding{PairAddress: "PairWIN", BaseTokenSymbol: "WIN"}, 1.10, c.reason)
+
+			var at time.Time
+			for i, price := range c.prices {
+				at = testStart.Add(time.Duration(i+1) * refreshInterval)
+				scanAt(at, []Pair{testPair("WIN", price)})
+			}
+			candidate := testCandidate("WIN", c.prices[len(c.prices)-1])
+			if got, detail := profitReentry(candidate, window); got != c.want {
+				t.Errorf("profitReentry = %t (%s), want %t", got, detail, c.want)
+			}
+			if got, _ := profitReentry(candidate, 0); got {
+				t.Error("re-entry allowed with the window off")
+			}
+			now = func() time.Time { return testStart.Add(window + time.Second) }
+			if got, _ := profitReentry(candidate, window); got {
+				t.Error("re-entry allowed after the window closed")
+			}
+		})
+	}
+}
+
+// --- Scan State ---
+
+// Run with -race: the status endpoints read scanState from their own goroutines while
+// runScan writes it
+func TestScanStateConcurrentReaders(t *testing.T) {
+	newTestBot(t)
+	fixtures := benchFixtures(50)
+	const cycles, readers = 200, 4
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr := fmt.Sprintf("BenchPair%05d", r)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				status := scanState.Status()
+				for i := range status.Candidates {
+					status.Candidates[i].Score = -1 // Readers own their copy
+				}
+				if len(status.Holding.RungsFilled) > 0 {
+					status.Holding.RungsFilled[0] = !status.Holding.RungsFilled[0]
+				}
+				if history := scanState.History(addr); len(history) > 0 {
+					history[0].PriceNative = -1
+				}
+				_ = scanState.CycleHistory()
+				_ = scanState.Watchlist()
+				_ = scanState.Streak(addr)
+				_ = scanState.UnchangedFor(addr, testStart)
+			}
+		}()
+	}
+
+	for i := range cycles {
+		scanAt(testStart.Add(time.Duration(i)*refreshInterval), fixtures[i%len(fixtures)])
+	}
+	close(done)
+	wg.Wait()
+
+	status := scanState.Status()
+	if status.Cycle != cycles {
+		t.Errorf("status cycle %d, want %d", status.Cycle, cycles)
+	}
+	for _, c := range status.Candidates {
+		if c.Score < 0 {
+			t.Fatalf("a reader's write reached the shared candidates: %+v", c)
+		}
+	}
+	for _, s := range scanState.History("BenchPair00000") {
+		if s.PriceNative < 0 {
+			t.Fatal("a reader's write reached the shared history")
+		}
+	}
+}
+
+func TestQualifyingStreak(t *testing.T) {
+	newTestBot(t)
+	above, below := entryThreshold()+0.1, entryThreshold()-0.1
+	for i, c := range []struct {
+		scored       map[string]float64 // PairAddress -> this cycle's score; absent = not scored
+		wantA, wantB int
+	}{
+		{map[string]float64{"A": above, "B": above}, 1, 1},
+		{map[string]float64{"A": above, "B": above}, 2, 2},
+		{map[string]float64{"A": above, "B": below}, 3, 0}, // B dips: reset
+		{map[string]float64{"A": above, "B": above}, 4, 1},
+		{map[string]float64{"B": above}, 0, 2}, // A filtered out or missing: reset
+		{map[string]float64{"A": entryThreshold(), "B": above}, 1, 3},
+	} {
+		var scored []TokenInfo
+		for addr, score := range c.scored {
+			scored = append(scored, TokenInfo{PairAddress: addr, Score: score})
+		}
+		scanState.UpdateStreaks(scored)
+		if a, b := scanState.Streak("A"), scanState.Streak("B"); a != c.wantA || b != c.wantB {
+			t.Fatalf("cycle %d: streaks A %d B %d, want %d and %d", i+1, a, b, c.wantA, c.wantB)
+		}
+	}
+}
+
+func TestStaleDataDetection(t *testing.T) {
+	newTestBot(t)
+	monitorOnly = true // Only the freshness tracking is under test
+	t.Cleanup(func() { monitorOnly = false })
+
+	frozen := testPair("FRZ", 0.001)
+	cycles := int(maxDataStaleness/refreshInterval) + 2
+	for i := range cycles {
+		at := testStart.Add(time.Duration(i) * refreshInterval)
+		// MOV changes every cycle, so the batch as a whole never looks like a stalled feed
+		scanAt(at, []Pair{frozen, testPair("MOV", 0.001*(1+0.01*float64(i)))})
+		if want := at.Sub(testStart) > maxDataStaleness; isPairDataStale("PairFRZ") != want {
+			t.Fatalf("cycle %d, unchanged for %v: stale %t, want %t", i, at.Sub(testStart), !want, want)
+		}
+		if isPairDataStale("PairMOV") {
+			t.Fatalf("cycle %d: a pair whose metrics change every cycle went stale", i)
+		}
+	}
+
+	if c, ok := firstFreshCandidate([]TokenInfo{testCandidate("FRZ", 0.001), testCandidate("MOV", 0.001)}); !ok || c.PairAddress != "PairMOV" {
+		t.Errorf("first fresh candidate %q (found %t), want the stale FRZ skipped for PairMOV", c.PairAddress, ok)
+	}
+
+	moved := testPair("FRZ", 0.0011)
+	scanAt(testStart.Add(time.Duration(cycles)*refreshInterval), []Pair{moved, testPair("MOV", 0.002)})
+	if isPairDataStale("PairFRZ") {
+		t.Error("still stale after its metrics changed")
+	}
+}
+
+func TestQuietModeBackoffAndSnapBack(t *testing.T) {
+	newTestBot(t)
+	monitorOnly = true // Keep the wallet flat: a held position never backs off
+	t.Cleanup(func() { monitorOnly = false })
+	cycle := 0
+	scan := func(pairs []Pair) time.Duration {
+		scanAt(testStart.Add(time.Duration(cycle)*refreshInterval), pairs)
+		cycle++
+		return pollInterval()
+	}
+	dead := benchPairs(20, 0, benchSOLPriceUSD)
+	for i := range dead {
+		dead[i].Liquidity.Usd = 0 // Nothing passes the filters
+	}
+
+	for i := 1; i < quietCyclesBeforeBackoff; i++ {
+		if got := scan(dead); got != refreshInterval {
+			t.Fatalf("%d empty cycles: polling every %v, want %v until quiet mode", i, got, refreshInterval)
+		}
+	}
+	want := refreshInterval
+	for i := quietCyclesBeforeBackoff; want < maxQuietInterval; i++ {
+		want = min(time.Duration(float64(want)*quietBackoffFactor), maxQuietInterval)
+		if got := scan(dead); got != want {
+			t.Fatalf("%d empty cycles: polling every %v, want %v", i, got, want)
+		}
+	}
+	if got := scan(dead); got != maxQuietInterval {
+		t.Fatalf("deep in quiet mode: polling every %v, want the %v cap", got, maxQuietInterval)
+	}
+
+	holding.Active = true // A position to watch overrides the backoff
+	if got := pollInterval(); got != refreshInterval {
+		t.Errorf("holding a position in quiet mode: polling every %v, want %v", got, refreshInterval)
+	}
+	holding.Active = false
+
+	if got := scan(benchPairs(20, 1, benchSOLPriceUSD)); got != refreshInterval || emptyCycles != 0 {
+		t.Errorf("candidates back: polling every %v with %d empty cycles counted, want %v and 0", got, emptyCycles, refreshInterval)
+	}
+	if got := scan(dead); got != refreshInterval {
+		t.Errorf("one empty cycle after snapping back: polling every %v, want %v", got, refreshInterval)
+	}
+}
+
+func TestEvictionByAge(t *testing.T) {
+	newTestBot(t)
+	pairs := benchPairs(3, 0, benchSOLPriceUSD)
+	gone, held, active := pairs[0].PairAddress, pairs[1].PairAddress, pairs[2].PairAddress
+	scanState.TrackPairs(pairs, testStart)
+	lastSeen := testStart.Add(historyEvictionAge)
+	scanState.TrackPairs(pairs[2:], lastSeen)
+	loggedSymbolDenials[gone] = true
+
+	now = func() time.Time { return lastSeen.Add(time.Second) } // gone and held just past the age
+	holding.PairAddress = held
+	evictPairState()
+	if len(scanState.History(gone)) != 0 || scanState.UnchangedFor(gone, now()) != 0 || loggedSymbolDenials[gone] {
+		t.Errorf("%s, unseen for over %v, kept some of its state", gone, historyEvictionAge)
+	}
+	if len(scanState.History(held)) == 0 {
+		t.Errorf("held pair %s evicted", held)
+	}
+	if len(scanState.History(active)) != 2 {
+		t.Errorf("%s, seen %v ago, has %d samples, want both kept", active, time.Second, len(scanState.History(active)))
+	}
+
+	scanState.TrackPairs(pairs[2:], lastSeen.Add(historyEvictionAge)) // active keeps showing up
+	holding.PairAddress = ""
+	now = func() time.Time { return lastSeen.Add(historyEvictionAge) }
+	if evicted, _ := scanState.Evict(now(), ""); !slices.Equal(evicted, []string{held}) {
+		t.Errorf("evicted %v once %s was no longer held, want just it", evicted, held)
+	}
+}
+
+func TestEvictionCap(t *testing.T) {
+	newTestBot(t)
+	const over = 5
+	pairs := benchPairs(maxTrackedPairs+over, 0, benchSOLPriceUSD)
+	for i, p := range pairs { // Pair i last seen i seconds in, so age orders them
+		scanState.TrackPairs([]Pair{p}, testStart.Add(time.Duration(i)*time.Second))
+	}
+
+	keep := pairs[0].PairAddress // Least recently seen, but held
+	evicted, overCap := scanState.Evict(testStart.Add(time.Hour), keep)
+	var want []string
+	for _, p := range pairs[1 : over+1] {
+		want = append(want, p.PairAddress)
+	}
+	slices.Sort(evicted)
+	if overCap != over || !slices.Equal(evicted, want) {
+		t.Fatalf("evicted %v (%d over the cap), want the %d least recently seen after the held pair: %v", evicted, overCap, over, want)
+	}
+	if tracked := scanState.Status().TrackedPairs; tracked != maxTrackedPairs {
+		t.Errorf("tracking %d pairs, want the %d cap", tracked, maxTrackedPairs)
+	}
+	if len(scanState.History(keep)) == 0 {
+		t.Error("held pair evicted to enforce the cap")
+	}
+}
+
+func TestCycleHistoryWrapsOldestFirst(t *testing.T) {
+	st := newScanState()
+	for cycle := 1; cycle <= historyCycles+3; cycle++ {
+		st.mu.Lock()
+		st.addSummary(CycleSummary{Cycle: cycle})
+		st.mu.Unlock()
+	}
+	history := st.CycleHistory()
+	if len(history) != historyCycles {
+		t.Fatalf("history holds %d summaries, want %d", len(history), historyCycles)
+	}
+	for i, s := range history {
+		if want := i + 4; s.Cycle != want {
+			t.Fatalf("history[%d] is cycle %d, want %d (oldest first after wrapping)", i, s.Cycle, want)
+		}
+	}
+}
+
+func TestDeployedSOLSumsEntriesInWindow(t *testing.T) {
+	st := newScanState()
+	st.RecordDeployment("MintA", 0.5, testStart)
+	st.RecordDeployment("MintA", 0.25, testStart.Add(time.Hour))
+	st.RecordDeployment("MintA", 0.1, testStart.Add(2*time.Hour))
+	st.RecordDeployment("MintB", 1, testStart.Add(time.Hour))
+
+	if got := st.DeployedSOL("MintA", testStart); math.Abs(got-0.85) > 1e-12 {
+		t.Errorf("MintA deployed %g SOL across three entries, want 0.85", got)
+	}
+	if got := st.DeployedSOL("MintA", testStart.Add(time.Hour)); math.Abs(got-0.35) > 1e-12 {
+		t.Errorf("MintA deployed %g SOL since the second entry, want 0.35 (the first aged out)", got)
+	}
+	if got := st.DeployedSOL("MintA", testStart); math.Abs(got-0.35) > 1e-12 {
+		t.Errorf("MintA deployed %g SOL after pruning, want 0.35 (aged-out entries are dropped)", got)
+	}
+	if got := st.DeployedSOL("MintB", testStart); got != 1 {
+		t.Errorf("MintB deployed %g SOL, want 1 (tokens are capped separately)", got)
+	}
+	if got := st.DeployedSOL("MintA", testStart.Add(3*time.Hour)); got != 0 {
+		t.Errorf("MintA deployed %g SOL after its window, want 0", got)
+	}
+}
+
+// --- Split Exits ---
+
+func TestUnwindProfitLossSumsToNetProceeds(t *testing.T) {
+	dir := newTestBot(t)
+	ctx := context.Background()
+	openTestPosition(t, "UNW", 0.001)
+	costBasis, third := holding.CostBasisSOL, holding.AmountToken/3
+
+	// runScan's unwind: the first chunk starts it, later cycles sell the rest at their own prices
+	for i, price := range []float64{0.00092, 0.00085, 0.00079} {
+		now = func() time.Time { return testStart.Add(time.Duration(i+1) * refreshInterval) }
+		amount := third
+		if i == 2 {
+			amount = holding.AmountToken
+		}
+		if !sellHolding(ctx, amount, price, "Hard Stop Loss (Unwind)") {
+			t.Fatalf("chunk %d was not booked", i+1)
+		}
+		if i == 0 {
+			holding.UnwindReason, holding.UnwindStartPrice, holding.UnwindFills = "Hard Stop Loss", price, 1
+		}
+		if i < 2 && wallet.TradesMade != 0 {
+			t.Fatalf("trade counted after chunk %d, before the position was flat", i+1)
+		}
+	}
+	if holding.Active || wallet.TradesMade != 1 || wallet.ProfitableTrades != 0 {
+		t.Fatalf("after the last chunk: active %t, %d trades (%d profitable), want a flat position and 1 losing trade",
+			holding.Active, wallet.TradesMade, wallet.ProfitableTrades)
+	}
+
+	var sells int
+	var summedPL, netProceeds, positionPL float64
+	for _, e := range loggedTrades(t, dir) {
+		if e.Action != "SELL" {
+			continue
+		}
+		sells++
+		summedPL += e.ProfitLossSOL
+		netProceeds += e.SOLAmount - e.FeeSOL
+		if !e.Partial {
+			positionPL = e.PositionProfitLossSOL
+		}
+	}
+	if sells != 3 {
+		t.Fatalf("logged %d SELLs, want 3", sells)
+	}
+	if want := netProceeds - costBasis; math.Abs(summedPL-want) > reconcileToleranceSOL {
+		t.Errorf("fills' P/L sums to %.12f SOL, want net proceeds - cost basis = %.12f", summedPL, want)
+	}
+	if math.Abs(positionPL-summedPL) > reconcileToleranceSOL {
+		t.Errorf("closing fill reports position P/L %.12f SOL, fills sum to %.12f", positionPL, summedPL)
+	}
+}
+
+// --- Risk-Adjusted Ratios ---
+
+func TestRiskAdjustedRatiosHandComputed(t *testing.T) {
+	// Equity 100 -> 110 -> 99 -> 108.9 -> 119.79: returns +10%, -10%, +10%, +10%
+	returns := periodReturns([]float64{100, 110, 99, 108.9, 119.79})
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if want := []float64{0.1, -0.1, 0.1, 0.1}; !slices.EqualFunc(returns, want, near) {
+		t.Fatalf("returns %v, want %v", returns, want)
+	}
+
+	for _, c := range []struct {
+		name                    string
+		riskFree                float64 // Annual; 4 periods a year, so scale sqrt(4) = 2
+		wantSharpe, wantSortino float64
+	}{
+		// Mean 0.05, sample std dev sqrt(0.03/3) = 0.1, downside dev sqrt(0.01/4) = 0.05
+		{"no risk-free rate", 0, 0.05 / 0.1 * 2, 0.05 / 0.05 * 2},
+		// 1% a period: excess mean 0.04, same std dev, downside dev sqrt(0.11²/4) = 0.055
+		{"4% risk-free rate", 0.04, 0.04 / 0.1 * 2, 0.04 / 0.055 * 2},
+	} {
+		sharpe, sortino := riskAdjustedRatios(returns, c.riskFree, 4)
+		if !near(sharpe, c.wantSharpe) || !near(sortino, c.wantSortino) {
+			t.Errorf("%s: Sharpe %.6f Sortino %.6f, want %.6f and %.6f", c.name, sharpe, sortino, c.wantSharpe, c.wantSortino)
+		}
+	}
+
+	for _, c := range []struct {
+		name               string
+		returns            []float64
+		sharpeNaN, sortNaN bool
+	}{
+		{"single return", []float64{0.1}, true, true},
+		{"no variance", []float64{0.02, 0.02, 0.02}, true, true}, // And never below the rate
+		{"no downside", []float64{0.01, 0.03, 0.02}, false, true},
+	} {
+		sharpe, sortino := riskAdjustedRatios(c.returns, 0, 4)
+		if math.IsNaN(sharpe) != c.sharpeNaN || math.IsNaN(sortino) != c.sortNaN {
+			t.Errorf("%s: Sharpe %v Sortino %v, want NaN %t and %t", c.name, sharpe, sortino, c.sharpeNaN, c.sortNaN)
+		}
+	}
+}
+
+// --- File Source ---
+
+func TestFileSourceShapes(t *testing.T) {
+	pairJSON := func(symbol string) string {
+		data, err := json.Marshal(testPair(symbol, 0.001))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	a, b, c := pairJSON("FSA"), pairJSON("FSB"), pairJSON("FSC")
+
+	cases := []struct {
+		name   string
+		body   string
+		cycles [][]string // Pair addresses served per fetch; a single entry repeats forever
+	}{
+		{"envelope", `{"schemaVersion":"1.0.0","pairs":[` + a + `,` + b + `]}`, [][]string{{"PairFSA", "PairFSB"}}},
+		{"single pair", `{"pair":` + a + `}`, [][]string{{"PairFSA"}}},
+		{"bare pairs", `[` + a + `,` + b + `]`, [][]string{{"PairFSA", "PairFSB"}}},
+		{"per-cycle batches", `[{"pairs":[` + a + `]}, [` + b + `,` + c + `], {"pair":` + c + `}]`,
+			[][]string{{"PairFSA"}, {"PairFSB", "PairFSC"}, {"PairFSC"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := newTestBot(t)
+			path := filepath.Join(dir, "pairs.json")
+			if err := os.WriteFile(path, []byte(tc.body), 0644); err != nil {
+				t.Fatal(err)
+			}
+			source, n, err := fileSource(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repeats := len(tc.cycles) == 1
+			if want := len(tc.cycles); repeats && n != 0 || !repeats && n != want {
+				t.Fatalf("fileSource reports %d batches for %d cycles", n, want)
+			}
+
+			fetchPairs = source
+			for cycle := range len(tc.cycles) + 1 {
+				want := tc.cycles[min(cycle, len(tc.cycles)-1)]
+				pairs, err := source(context.Background())
+				if !repeats && cycle == len(tc.cycles) {
+					if err == nil {
+						t.Errorf("fetch past the last batch returned %d pairs, want an error", len(pairs))
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("cycle %d: %v", cycle+1, err)
+				}
+				var got []string
+				for _, p := range pairs {
+					got = append(got, p.PairAddress)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("cycle %d served %v, want %v", cycle+1, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("mixed", func(t *testing.T) {
+		dir := newTestBot(t)
+		path := filepath.Join(dir, "pairs.json")
+		if err := os.WriteFile(path, []byte(`[`+a+`, {"pairs":[`+b+`]}]`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := fileSource(path); err == nil {
+			t.Error("an array mixing pairs and batches was accepted")
+		}
+	})
+}
+
+// The per-cycle source drives runScan: one batch per cycle, its pairs the candidates
+func TestFileSourceAdvancesScanCycles(t *testing.T) {
+	dir := newTestBot(t)
+	monitorOnly = true
+	t.Cleanup(func() { monitorOnly = false })
+	var batches []string
+	for _, symbols := range [][]string{{"FS1", "FS2"}, {"FS2", "FS3"}, {"FS3", "FS4"}} {
+		var pairs []Pair
+		for _, s := range symbols {
+			pairs = append(pairs, testPair(s, 0.001))
+		}
+		data, err := json.Marshal(DexScreenerResponse{Pairs: pairs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, string(data))
+	}
+	path := filepath.Join(dir, "cycles.json")
+	if err := os.WriteFile(path, []byte("["+strings.Join(batches, ",")+"]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source, n, err := fileSource(path)
+	if err != nil || n != 3 {
+		t.Fatalf("fileSource: %d batches, %v", n, err)
+	}
+	fetchPairs = source
+
+	for i, want := range [][]string{{"PairFS1", "PairFS2"}, {"PairFS2", "PairFS3"}, {"PairFS3", "PairFS4"}} {
+		now = func() time.Time { return testStart.Add(time.Duration(i) * refreshInterval) }
+		runScan(context.Background())
+		status := scanState.Status()
+		var got []string
+		for _, c := range status.Candidates {
+			got = append(got, c.PairAddress)
+		}
+		slices.Sort(got)
+		if status.Cycle != i+1 || !reflect.DeepEqual(got, want) {
+			t.Errorf("cycle %d: status cycle %d, candidates %v, want %v", i+1, status.Cycle, got, want)
+		}
+	}
+}
+
+// --- Quote Tokens ---
+
+func TestSOLEquivalentQuotes(t *testing.T) {
+	newTestBot(t)
+	minTime := testStart.Add(-time.Duration(minPairAgeHours * float64(time.Hour)))
+	const mSOL, bSOL = "mSoLzYCxHdYgdzU16g5QSh3i5K3z3KZK7ytfqcJm7So", "bSo13r4TkiE4KumL71LsHTPpL2euBYLFx6h9HP3piy1"
+	lstPair := func(symbol, mint string) Pair {
+		p := testPair(symbol, 0.00085) // Priced in the LST, not SOL
+		p.QuoteToken = Token{Address: mint, Symbol: symbol}
+		p.PriceUsd = "0.15" // 0.001 SOL at 150 USD
+		return p
+	}
+
+	for _, accept := range []bool{false, true} {
+		acceptSOLEquivalentQuotes = accept
+		t.Cleanup(func() { acceptSOLEquivalentQuotes = defaultAcceptSOLEquivalentQuotes })
+		pairs := []Pair{lstPair("mSOL", mSOL), lstPair("bSOL", bSOL), testPair("SOLQ", 0.001)}
+		recordSOLPrice(pairs)
+		convertSOLEquivalentQuotes(pairs)
+
+		gates := map[string]string{}
+		for _, p := range pairs {
+			gates[p.QuoteToken.Symbol], _ = pairFilterGate(p, minTime)
+		}
+		want := map[string]string{"mSOL": "not_sol_quoted", "bSOL": "not_sol_quoted", "SOL": ""}
+		if accept {
+			want["mSOL"] = "" // Listed in solEquivalentQuoteMints; bSOL isn't
+		}
+		if !reflect.DeepEqual(gates, want) {
+			t.Errorf("accept %t: gates %v, want %v", accept, gates, want)
+		}
+		wantNative := "0.00085" // Left alone unless accepted
+		if accept {
+			wantNative = strconv.FormatFloat(0.15/benchSOLPriceUSD, 'g', -1, 64)
+		}
+		if got := parseFloat(string(pairs[0].PriceNative), 0); math.Abs(got-parseFloat(wantNative, 0)) > 1e-15 {
+			t.Errorf("accept %t: mSOL pair priceNative %g, want %s SOL", accept, got, wantNative)
+		}
+		if got := string(pairs[1].PriceNative); got != "0.00085" {
+			t.Errorf("accept %t: unaccepted LST repriced to %s", accept, got)
+		}
+	}
+}
+
+// --- Liquidity Metric ---
+
+func TestQuoteLiquidityMetric(t *testing.T) {
+	newTestBot(t)
+	solUSDHistory = []solPriceSample{{Time: testStart, PriceUSD: benchSOLPriceUSD}}
+	t.Cleanup(func() { liquidityMetric = defaultLiquidityMetric })
+	pairWithReserve := func(sym string, quoteUSD float64) Pair {
+		p := testPair(sym, 0.001) // liquidity.usd far above the minimum
+		p.Liquidity.Quote = flexFloat(quoteUSD / benchSOLPriceUSD)
+		return p
+	}
+	inflated := pairWithReserve("INFL", minLiquidityUSD/2) // Mostly base-token value
+	deep := pairWithReserve("DEEP", minLiquidityUSD*2)
+	noReserve := pairWithReserve("NORES", 0)
+
+	for _, c := range []struct {
+		metric   string
+		pair     Pair
+		want     float64
+		wantGate string
+	}{
+		{"usd", inflated, float64(inflated.Liquidity.Usd), ""},
+		{"usd", noReserve, float64(noReserve.Liquidity.Usd), ""},
+		{"quote", inflated, minLiquidityUSD / 2, "low_liquidity"},
+		{"quote", deep, minLiquidityUSD * 2, ""},
+		{"quote", noReserve, 0, "low_liquidity"},
+	} {
+		liquidityMetric = c.metric
+		sym := c.pair.BaseToken.Symbol
+		if got := pairLiquidityUSD(c.pair); math.Abs(got-c.want) > 1e-6 {
+			t.Errorf("%s, %s: liquidity %.2f USD, want %.2f", c.metric, sym, got, c.want)
+		}
+		if got := tokenInfoFromPair(c.pair).LiquidityUSD; math.Abs(got-c.want) > 1e-6 {
+			t.Errorf("%s, %s: candidate liquidity %.2f USD, want %.2f", c.metric, sym, got, c.want)
+		}
+		if gate, detail := pairFilterGate(c.pair, testStart); gate != c.wantGate {
+			t.Errorf("%s, %s: gate %q (%s), want %q", c.metric, sym, gate, detail, c.wantGate)
+		}
+	}
+
+	// Without a SOL/USD reference the reserve can't be valued: it counts as none
+	liquidityMetric, solUSDHistory = "quote", nil
+	if got := pairLiquidityUSD(deep); got != 0 {
+		t.Errorf("no SOL/USD reference: liquidity %.2f USD, want 0", got)
+	}
+}
+
+// --- Liquidity/Volume Ratio ---
+
+func TestLiquidityToVolumeRatioGate(t *testing.T) {
+	newTestBot(t)
+	minLiquidityToVolumeRatio = 2
+	t.Cleanup(func() { minLiquidityToVolumeRatio = defaultMinLiquidityToVolumeRatio })
+	minTime := testStart.Add(-time.Duration(minPairAgeHours * float64(time.Hour)))
+	const volume = 10_000.0
+
+	for _, tc := range []struct {
+		name      string
+		liquidity float64
+		volume    float64
+		ratio     float64
+		ok        bool
+		gate      string
+	}{
+		{"at the minimum", 2 * volume, volume, 2, true, ""},
+		{"just under", 2*volume - 1, volume, (2*volume - 1) / volume, true, "thin_liquidity"},
+		{"deep pool", 10 * volume, volume, 10, true, ""},
+		{"no volume", 2 * volume, 0, 0, false, "low_volume"}, // No ratio; the volume filter rejects it
+	} {
+		p := testPair("RATIO", 0.001)
+		p.Liquidity.Usd, p.Volume.M5 = flexFloat(tc.liquidity), flexFloat(tc.volume)
+		ratio, ok := liquidityToVolumeRatio(p)
+		if ok != tc.ok || math.Abs(ratio-tc.ratio) > 1e-12 {
+			t.Errorf("%s: ratio %g (ok %t), want %g (ok %t)", tc.name, ratio, ok, tc.ratio, tc.ok)
+		}
+		if gate, _ := pairFilterGate(p, minTime); gate != tc.gate {
+			t.Errorf("%s: gate %q, want %q", tc.name, gate, tc.gate)
+		}
+	}
+}
+
+// --- Data-Missing Exit ---
+
+func TestDataMissingExitNeedsCyclesAndGrace(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		interval  time.Duration
+		exitCycle int // Missing cycle the position is sold on
+	}{
+		// Three quick cycles are only 20s of absence: wait out the 2m grace period
+		{"quick cycles", 10 * time.Second, 1 + int(dataMissingGracePeriod/(10*time.Second))},
+		// One long cycle already outlasts the grace period: wait for the third cycle
+		{"slow cycles", 5 * time.Minute, 3},
+	} {
+		dir := newTestBot(t)
+		dataMissingExitCycles = 3
+		t.Cleanup(func() { dataMissingExitCycles = defaultDataMissingExitCycles })
+		openTestPosition(t, "GONE", 1)
+		monitorOnly = true // No re-entry into the batch the pair went missing from
+
+		scanAt(testStart.Add(c.interval), []Pair{testPair("GONE", 1.02)}) // Last seen price
+
+		for cycle := 1; cycle <= c.exitCycle; cycle++ {
+			scanAt(testStart.Add(time.Duration(cycle+1)*c.interval), benchPairs(3, cycle, benchSOLPriceUSD))
+			if cycle < c.exitCycle && !holding.Active {
+				t.Fatalf("%s: sold after %d missing cycles, want %d", c.name, cycle, c.exitCycle)
+			}
+		}
+		trades := loggedTrades(t, dir)
+		if holding.Active || len(trades) != 2 || !strings.HasPrefix(trades[1].Reason, "Data Missing") {
+			t.Fatalf("%s: want a Data Missing exit on missing cycle %d, got active %t, trades %+v", c.name, c.exitCycle, holding.Active, trades)
+		}
+		if trades[1].PriceNative != 1.02 {
+			t.Errorf("%s: sold at %g, want the last seen price 1.02", c.name, trades[1].PriceNative)
+		}
+	}
+}
+
+func TestDataMissingCountResetsWhenPairReturns(t *testing.T) {
+	newTestBot(t)
+	dataMissingExitCycles = 2
+	t.Cleanup(func() { dataMissingExitCycles = defaultDataMissingExitCycles })
+	openTestPosition(t, "BACK", 1)
+	monitorOnly = true
+	back := testPair("BACK", 1)
+	back.PriceChange.M5 = 5 // Momentum intact
+
+	for i, pairs := range [][]Pair{
+		benchPairs(3, 1, benchSOLPriceUSD), // Missing
+		{back},                             // Back: the count starts over
+		benchPairs(3, 2, benchSOLPriceUSD), // Missing again, but only once in a row
+	} {
+		scanAt(testStart.Add(time.Duration(i+1)*5*time.Minute), pairs)
+	}
+	if !holding.Active || holding.DataMissingCycles != 1 {
+		t.Errorf("after a return and one more miss: active %t, %d missing cycles; want held, 1", holding.Active, holding.DataMissingCycles)
+	}
+}
+
+// --- Data Anomalies ---
+
+func TestPairDataAnomalies(t *testing.T) {
+	newTestBot(t)
+	minTime := testStart.Add(-time.Duration(minPairAgeHours * float64(time.Hour)))
+	for _, tc := range []struct {
+		name       string
+		edit       func(p *Pair)
+		impossible []string
+		clamped    []string
+	}{
+		{"zeros and a -100% drop are possible", func(p *Pair) {
+			p.Liquidity.Base, p.Liquidity.Quote, p.Volume.H1 = 0, 0, 0
+			p.Txns.M5 = BuysSells{}
+			p.PriceChange.H1 = -100
+		}, nil, nil},
+		{"negative liquidity", func(p *Pair) { p.Liquidity.Usd = -5 }, []string{"liquidity.usd=-5"}, nil},
+		{"negative price", func(p *Pair) { p.PriceUsd = "-0.1" }, []string{"priceUsd=-0.1"}, nil},
+		{"drop past -100%", func(p *Pair) { p.PriceChange.M5 = -150 }, []string{"priceChange.m5=-150"}, nil},
+		{"negative volume and txns", func(p *Pair) {
+			p.Volume.M5, p.Txns.M5.Sells = -1, -3
+		}, nil, []string{"volume.m5=-1", "txns.m5.sells=-3"}},
+	} {
+		p := testPair("ANOM", 0.001)
+		tc.edit(&p)
+		impossible, clamped := pairDataAnomalies(p)
+		if !slices.Equal(impossible, tc.impossible) || !slices.Equal(clamped, tc.clamped) {
+			t.Errorf("%s: impossible %q, clamped %q; want %q, %q", tc.name, impossible, clamped, tc.impossible, tc.clamped)
+		}
+		if gate, _ := pairFilterGate(p, minTime); (gate == "bad_data") != (len(tc.impossible) > 0) {
+			t.Errorf("%s: filter gate %q; only impossible values should skip the pair as bad_data", tc.name, gate)
+		}
+	}
+
+	// Clamped values count as zero rather than dragging the score negative
+	p := testPair("ANOM", 0.001)
+	p.Volume.M5, p.Txns.M5.Sells = -1, -3
+	if info := tokenInfoFromPair(p); info.VolumeM5 != 0 || info.M5BuySellRatio != calculateBuySellRatio(int(p.Txns.M5.Buys), 0) {
+		t.Errorf("negative volume/txns not treated as zero: volume %g, buy/sell %g", info.VolumeM5, info.M5BuySellRatio)
+	}
+}
+
+// --- Default-On Gates ---
+
+func TestPriceMismatchGate(t *testing.T) {
+	newTestBot(t)
+	solUSDHistory = []solPriceSample{{Time: testStart, PriceUSD: benchSOLPriceUSD}}
+	const native = 0.001
+	for _, c := range []struct {
+		name     string
+		offBy    float64 // priceUsd vs priceNative × SOL/USD, percent
+		wantGate string
+	}{
+		{"consistent", 0, ""},
+		{"within the limit", maxPriceDiscrepancyPercent - 1, ""},
+		{"divergent", maxPriceDiscrepancyPercent + 1, "price_mismatch"},
+		{"far divergent", -60, "price_mismatch"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := testPair("PX", native)
+			// Off by offBy percent of priceUsd itself, the discrepancy's denominator
+			p.PriceUsd = flexString(strconv.FormatFloat(native*benchSOLPriceUSD/(1+c.offBy/100), 'g', -1, 64))
+			if gate, detail := pairFilterGate(p, testStart); gate != c.wantGate {
+				t.Errorf("gate %q (%s), want %q", gate, detail, c.wantGate)
+			}
+		})
+	}
+
+	t.Run("no SOL/USD reference", func(t *testing.T) {
+		solUSDHistory = nil
+		p := testPair("PX", native)
+		p.PriceUsd = "1000"
+		if gate, _ := pairFilterGate(p, testStart); gate != "" {
+			t.Errorf("gate %q with nothing to compare against, want the pair let through", gate)
+		}
+	})
+}
+
+func TestSpoofedSymbolGate(t *testing.T) {
+	newTestBot(t)
+	for _, c := range []struct {
+		symbol  string
+		spoofed bool
+	}{
+		{"USDC", false},
+		{"BONK", false},
+		{"PEPE2", false},
+		{"猫coin", false},                   // Latin + Han is an ordinary mix
+		{"Привет", false},                  // Cyrillic, but not posing as Latin
+		{"USD\u0421", true},                // Cyrillic Es
+		{"\u0420\u0415\u0420\u0415", true}, // All-Cyrillic "PEPE"
+		{"ＢＯＮＫ", true},                     // Fullwidth
+		{"BO\u200bNK", true},               // Zero-width space
+	} {
+		p := testPair("SPF", 0.001)
+		p.BaseToken.Symbol = c.symbol
+		gate, detail := pairFilterGate(p, testStart)
+		if got := gate == "spoofed_symbol"; got != c.spoofed || (!c.spoofed && gate != "") {
+			t.Errorf("%q (%+q): gate %q (%s), want spoofed %t", c.symbol, c.symbol, gate, detail, c.spoofed)
+		}
+	}
+}
+
+func TestSpoofedSOLQuoteRejected(t *testing.T) {
+	dir := newTestBot(t)
+	scam := testPair("SCAM", 0.001)
+	scam.QuoteToken = Token{Address: "So11111111111111111111111111111111111111113", Symbol: "SOL"} // One digit off
+	if gate, detail := pairFilterGate(scam, testStart); gate != "not_sol_quoted" {
+		t.Errorf("quote named SOL with mint %s: gate %q (%s), want not_sol_quoted", scam.QuoteToken.Address, gate, detail)
+	}
+	if gate, detail := pairFilterGate(testPair("REAL", 0.001), testStart); gate != "" {
+		t.Errorf("quote in wrapped SOL: gate %q (%s), want the pair let through", gate, detail)
+	}
+
+	// Batches that buy within these cycles when quoted in real wrapped SOL
+	for i := range 3 {
+		batch := benchPairs(50, i, benchSOLPriceUSD)
+		for j := range batch {
+			batch[j].QuoteToken = scam.QuoteToken
+		}
+		scanAt(testStart.Add(time.Duration(i)*refreshInterval), batch)
+	}
+	if holding.Active || len(loggedTrades(t, dir)) != 0 {
+		t.Errorf("bought %s quoted in a fake SOL", holding.BaseTokenSymbol)
+	}
+}
+
+func TestFeedStallDetection(t *testing.T) {
+	newTestBot(t)
+	batch := benchPairs(20, 0, benchSOLPriceUSD)
+	for i := 1; i <= stallCycles+1; i++ {
+		scanCycles = i
+		checkFeedStall(batch)
+		if want := i >= stallCycles; feedStalled != want {
+			t.Fatalf("after %d identical batches: stalled %t, want %t", i, feedStalled, want)
+		}
+	}
+	scanCycles++
+	checkFeedStall(benchPairs(20, 1, benchSOLPriceUSD))
+	if feedStalled {
+		t.Fatal("still stalled after a changed batch")
+	}
+
+	newTestBot(t)
+	for i := 1; i <= 3*stallCycles; i++ {
+		scanCycles = i
+		checkFeedStall(benchPairs(20, i, benchSOLPriceUSD))
+		if feedStalled {
+			t.Fatalf("a batch that changes every cycle stalled at cycle %d", i)
+		}
+	}
+}
+
+func TestFeedStallPausesEntries(t *testing.T) {
+	dir := newTestBot(t)
+	stale := benchPairs(50, 0, benchSOLPriceUSD)
+	monitorOnly = true // No entries while the repeats build up
+	for i := range stallCycles - 1 {
+		scanAt(testStart.Add(time.Duration(i)*refreshInterval), stale)
+	}
+	monitorOnly = false
+
+	scanAt(testStart.Add(time.Duration(stallCycles)*refreshInterval), stale)
+	if !feedStalled || holding.Active || len(loggedTrades(t, dir)) != 0 {
+		t.Fatalf("stalled %t, holding %t, %d trades: want a stalled feed and no BUY", feedStalled, holding.Active, len(loggedTrades(t, dir)))
+	}
+
+	scanAt(testStart.Add(time.Duration(stallCycles+1)*refreshInterval), benchPairs(50, 1, benchSOLPriceUSD))
+	if feedStalled || !holding.Active {
+		t.Fatalf("after a fresh batch: stalled %t, holding %t, want entries resumed", feedStalled, holding.Active)
+	}
+}
+
+func TestRugBlacklistUntilExpiry(t *testing.T) {
+	newTestBot(t)
+	openTestPosition(t, "RUG", 0.001)
+	rugged := testPair("RUG", 0.001)
+	rugged.Liquidity.Usd = flexFloat(holding.EntryLiquidityUSD * (1 - liquidityDropPercent) / 2)
+	exitAt := testStart.Add(refreshInterval)
+	scanAt(exitAt, []Pair{rugged})
+	if holding.Active {
+		t.Fatal("liquidity drop did not close the position")
+	}
+
+	healthy := testPair("RUG", 0.001)
+	for _, c := range []struct {
+		after    time.Duration
+		wantGate string
+	}{
+		{time.Minute, "rug_blacklisted"},
+		{rugBlacklistTTL - time.Second, "rug_blacklisted"},
+		{rugBlacklistTTL, ""}, // Expired
+	} {
+		now = func() time.Time { return exitAt.Add(c.after) }
+		if gate, detail := pairFilterGate(healthy, testStart); gate != c.wantGate {
+			t.Errorf("%v after the rug exit: gate %q (%s), want %q", c.after, gate, detail, c.wantGate)
+		}
+	}
+}
+
+func TestRugBlacklistOnlyAfterRugExits(t *testing.T) {
+	newTestBot(t)
+	openTestPosition(t, "DIP", 0.001)
+	scanAt(testStart.Add(refreshInterval), []Pair{testPair("DIP", 0.001*(1-hardStopLossPercent-0.02))})
+	if holding.Active {
+		t.Fatal("hard stop did not close the position")
+	}
+	if gate, _ := pairFilterGate(testPair("DIP", 0.001), testStart); gate != "" {
+		t.Errorf("gate %q after a hard stop, want no ban (only liquidity-drop exits are rugs)", gate)
+	}
+}
+
+// The ban outlives a restart of a live run
+func TestRugBlacklistPersists(t *testing.T) {
+	newTestBot(t)
+	backtesting = false
+	t.Cleanup(func() { backtesting = true })
+	blacklistRuggedToken("MintPERSIST", "PERSIST")
+
+	rugBlacklist = map[string]time.Time{}
+	loadRugBlacklist()
+	if until, ok := rugBlacklistedUntil("MintPERSIST"); !ok || !until.Equal(testStart.Add(rugBlacklistTTL)) {
+		t.Errorf("after reload: banned %t until %v, want until %v", ok, until, testStart.Add(rugBlacklistTTL))
+	}
+}
+
+// --- Kill Switch ---
+
+func TestKillSwitchTransitions(t *testing.T) {
+	dir := newTestBot(t)
+	backtesting = false // The kill switch is live only
+	t.Cleanup(func() { backtesting = true })
+	configured := killSwitchPath
+	killSwitchPath = filepath.Join(dir, "STOP")
+	t.Cleanup(func() { killSwitchPath = configured })
+	engage := func() {
+		if err := os.WriteFile(killSwitchPath, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release := func() {
+		if err := os.Remove(killSwitchPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cycle := 0
+	scan := func() {
+		scanAt(testStart.Add(time.Duration(cycle)*refreshInterval), benchPairs(50, cycle, benchSOLPriceUSD))
+		cycle++
+	}
+
+	engage()
+	scan()
+	if !killSwitchEngaged || holding.Active || len(loggedTrades(t, dir)) != 0 {
+		t.Fatalf("STOP present: engaged %t, holding %t, %d trades, want engaged and no BUY", killSwitchEngaged, holding.Active, len(loggedTrades(t, dir)))
+	}
+
+	release()
+	scan()
+	if killSwitchEngaged || !holding.Active {
+		t.Fatalf("STOP removed: engaged %t, holding %t, want entries resumed", killSwitchEngaged, holding.Active)
+	}
+
+	engage() // Entries-only mode keeps the open position
+	pendingOrder = PendingOrder{Active: true, BaseTokenSymbol: "PEND"}
+	checkKillSwitch()
+	if !killSwitchEngaged || !holding.Active || pendingOrder.Active {
+		t.Fatalf("STOP present again: engaged %t, holding %t, pending order %t, want engaged, position kept, order cancelled",
+			killSwitchEngaged, holding.Active, pendingOrder.Active)
+	}
+
+	release()
+	checkKillSwitch()
+	killSwitchFlatten = true
+	t.Cleanup(func() { killSwitchFlatten = defaultKillSwitchFlatten })
+	engage()
+	scan()
+	trades := loggedTrades(t, dir)
+	if last := trades[len(trades)-1]; holding.Active || !strings.HasPrefix(last.Reason, "Kill Switch") {
+		t.Fatalf("STOP present in flatten mode: holding %t, last trade %s %q, want the position sold by the kill switch", holding.Active, last.Action, last.Reason)
+	}
+}
+
+func TestSortCandidatesBreaksTiesDeterministically(t *testing.T) {
+	want := []string{"Best", "TieDeepPool", "TieA", "TieB", "TieC", "Worst"}
+	candidates := []TokenInfo{
+		{PairAddress: "Best", Score: 0.9, LiquidityUSD: 10_000},
+		{PairAddress: "TieDeepPool", Score: 0.5, LiquidityUSD: 90_000},
+		{PairAddress: "TieA", Score: 0.5, LiquidityUSD: 50_000},
+		{PairAddress: "TieB", Score: 0.5, LiquidityUSD: 50_000},
+		{PairAddress: "TieC", Score: 0.5, LiquidityUSD: 50_000},
+		{PairAddress: "Worst", Score: 0.1, LiquidityUSD: 200_000},
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 20 { // A quiet batch normalizes flat, in whatever order the API sent it
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		sortCandidates(candidates)
+		var got []string
+		for _, c := range candidates {
+			got = append(got, c.PairAddress)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("sorted %v, want %v", got, want)
+		}
+	}
+}
+
+// --- Amount Formatting ---
+
+func TestFormatAmountPrecisionByMagnitude(t *testing.T) {
+	for _, tc := range []struct {
+		value float64
+		kind  AmountKind
+		want  string
+	}{
+		{1234567.5, AmountSOL, "1234567.50"}, // Large: clamped up to MinDecimals
+		{1.5, AmountSOL, "1.50000"},
+		{0.000123456789, AmountSOL, "0.000123457"},
+		{-0.05, AmountSOL, "-0.0500000"},
+		{0, AmountSOL, "0.00"},
+		{0.0000001234, AmountPrice, "0.000000123400"},
+		{1.234e-10, AmountPrice, "0.00000000012340"}, // Clamped down to MaxDecimals
+		{1234.5678, AmountUSD, "1234.57"},
+		{0.001234, AmountUSD, "0.001234"},
+		{12345.678, AmountToken, "12345.7"},
+	} {
+		if got := formatAmount(tc.value, tc.kind); got != tc.want {
+			t.Errorf("formatAmount(%g, %d) = %q, want %q", tc.value, tc.kind, got, tc.want)
+		}
+	}
+}
+
+func TestFormatTokenAmountsCompact(t *testing.T) {
+	const tinyPrice = 1e-10 // SOL per token; 1 SOL buys ten billion
+	for _, tc := range []struct {
+		value float64
+		want  string
+	}{
+		{999999, "999999"}, // Below compactTokenAmountsAbove: plain digits
+		{compactTokenAmountsAbove, "1.00M"},
+		{12345678, "12.35M"},
+		{-2.5e6, "-2.50M"},
+		{4.5e9, "4.50B"},
+		{1 / tinyPrice, "10.00B"},
+		{7.891e12, "7.89T"},
+		{1.2346e15, "1.235e+15"}, // Past trillions: scientific
+		{math.Inf(1), "+Inf"},
+	} {
+		if got := formatAmount(tc.value, AmountToken); got != tc.want {
+			t.Errorf("formatAmount(%g, AmountToken) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+	if got, want := formatAmount(tinyPrice, AmountPrice), "0.00000000010000"; got != want {
+		t.Errorf("tiny price formatted %q, want %q", got, want)
+	}
+}
+
+// --- Report Locale ---
+
+func TestReportNumbersByLocale(t *testing.T) {
+	saved := reportPrinter
+	t.Cleanup(func() { reportPrinter = saved })
+	for _, tc := range []struct {
+		locale string
+		number []string // 1234567.891, -1234567.891 signed, -0.001
+		usd    []string // 1234.5, -1234.5 signed, 0.5 signed
+	}{
+		{"", []string{"1234567.89", "-1234567.89", "-0.00"}, []string{"1234.50", "-1234.50", "+0.50"}},
+		{"en-US", []string{"1,234,567.89", "-1,234,567.89", "-0.00"}, []string{"$1,234.50", "-$1,234.50", "+$0.50"}},
+		{"de-DE", []string{"1.234.567,89", "-1.234.567,89", "-0,00"}, []string{"$1.234,50", "-$1.234,50", "+$0,50"}},
+	} {
+		reportPrinter = nil
+		if tc.locale != "" {
+			reportPrinter = message.NewPrinter(language.MustParse(tc.locale))
+		}
+		numbers := []string{reportNumber(1234567.891, 2, false), reportNumber(-1234567.891, 2, true), reportNumber(-0.001, 2, false)}
+		usd := []string{reportUSD(1234.5, false), reportUSD(-1234.5, true), reportUSD(0.5, true)}
+		if !slices.Equal(numbers, tc.number) || !slices.Equal(usd, tc.usd) {
+			t.Errorf("locale %q: numbers %q, USD %q; want %q, %q", tc.locale, numbers, usd, tc.number, tc.usd)
+		}
+	}
+}
+
+// --- Secrets ---
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(secretFile, []byte("  from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	blankFile := filepath.Join(dir, "blank")
+	if err := os.WriteFile(blankFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_SET", "from-env")
+	t.Setenv("TEST_SECRET_EMPTY", "")
+
+	for _, c := range []struct {
+		ref, want string
+		wantErr   bool
+	}{
+		{"plain-value", "plain-value", false},
+		{"", "", false}, // Unset settings stay unset
+		{"file:" + secretFile, "from-file", false},
+		{"file:" + blankFile, "", true},
+		{"file:" + filepath.Join(dir, "missing"), "", true},
+		{"env:TEST_SECRET_SET", "from-env", false},
+		{"env:TEST_SECRET_EMPTY", "", true},
+		{"env:TEST_SECRET_NEVER_SET", "", true},
+	} {
+		got, err := resolveSecret(c.ref)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("resolveSecret(%q) = %q, %v; want %q, error %t", c.ref, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+// --- Effective Config ---
+
+func TestConfigGroupsStayFlat(t *testing.T) {
+	cfg := resolveConfig()
+	cfg.AdminToken = "hunter2"
+	cfg.NotifyWebhookURL = "https://hooks.example/T0K3N"
+	cfg.JupiterQuoteAPI = "https://user:pw@quote.example/v6"
+
+	data, err := json.Marshal(redactConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump map[string]any
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range []string{"ControlConfig", "AlertConfig", "JupiterConfig"} {
+		if _, ok := dump[group]; ok {
+			t.Errorf("-print-config nests %s, want its fields at the top level", group)
+		}
+	}
+	if dump["adminToken"] != redactedValue || dump["notifyWebhookUrl"] != redactedValue {
+		t.Errorf("secrets in feature groups printed as %v, %v, want %s", dump["adminToken"], dump["notifyWebhookUrl"], redactedValue)
+	}
+	if api, _ := dump["jupiterQuoteApi"].(string); strings.Contains(api, "pw") {
+		t.Errorf("jupiterQuoteApi printed as %q, want the password masked", api)
+	}
+}
+
+// --- Config Preview ---
+
+func TestPreviewConfigSplitsPreviewedFromIgnored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edited.json")
+	if err := os.WriteFile(path, []byte(`{"minScoreToEnter": 0.1, "hardStopLossPercent": 9, "adminToken": "x"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, previewed, ignored, err := loadPreviewConfig(path, resolveConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(previewed) != 1 || !strings.HasPrefix(previewed[0], "minScoreToEnter ") || !slices.Equal(ignored, []string{"hardStopLossPercent"}) {
+		t.Errorf("preview applied %q and ignored %q, want minScoreToEnter applied and hardStopLossPercent ignored", previewed, ignored)
+	}
+}
+
+func TestPreviewSelectComparesOldAndNewPicks(t *testing.T) {
+	newTestBot(t)
+	pairs := benchPairs(5, 0, benchSOLPriceUSD)
+	current := resolveConfig()
+	current.MinScoreToEnter = 0 // Whatever tops the batch is a BUY
+	before := previewSelect(current, pairs)
+	if before.PairAddress == "" || before.Candidates != len(pairs) || !before.Enter {
+		t.Fatalf("current config picked %+v, want a BUY-level pick among %d candidates", before, len(pairs))
+	}
+
+	deepest := pairs[0]
+	for _, p := range pairs {
+		if p.Liquidity.Usd > deepest.Liquidity.Usd {
+			deepest = p
+		}
+	}
+	withCfg := func(edit func(*StrategyConfig)) StrategyConfig {
+		cfg := current
+		cfg.ScoringWeights = maps.Clone(current.ScoringWeights)
+		edit(&cfg)
+		return cfg
+	}
+	for _, c := range []struct {
+		name      string
+		cfg       StrategyConfig
+		wantPair  string
+		wantCount int
+		wantEnter bool
+	}{
+		{"unchanged", current, before.PairAddress, len(pairs), true},
+		{"threshold above the top score", withCfg(func(cfg *StrategyConfig) { cfg.MinScoreToEnter = before.Score + 0.01 }),
+			before.PairAddress, len(pairs), false},
+		{"liquidity-only weights", withCfg(func(cfg *StrategyConfig) {
+			for k := range cfg.ScoringWeights {
+				cfg.ScoringWeights[k] = 0
+			}
+			cfg.ScoringWeights["liquidity"] = 1
+		}), deepest.PairAddress, len(pairs), true},
+		{"liquidity minimum above the batch", withCfg(func(cfg *StrategyConfig) { cfg.MinLiquidityUSD = float64(deepest.Liquidity.Usd) + 1 }),
+			"", 0, false},
+	} {
+		got := previewSelect(c.cfg, pairs)
+		if got.PairAddress != c.wantPair || got.Candidates != c.wantCount || got.Enter != c.wantEnter {
+			t.Errorf("%s: picked %s of %d (enter %t), want %q of %d (enter %t)",
+				c.name, got, got.Candidates, got.Enter, c.wantPair, c.wantCount, c.wantEnter)
+		}
+	}
+	if got := previewSelect(current, pairs); got != before {
+		t.Errorf("previewing an edit changed the current config's pick: %+v, was %+v", got, before)
+	}
+}
+
+// --- Balance Alerts ---
+
+func TestBalanceAlertsCrossAndRearm(t *testing.T) {
+	newTestBot(t)
+	logs := captureLog(t)
+	for _, step := range []struct {
+		equity float64
+		alerts int // ALERT lines this step
+	}{
+		{10, 0},   // Inside the band
+		{8.5, 1},  // Falls below the floor
+		{8, 0},    // Still below: already fired
+		{9.5, 0},  // Back inside: re-armed
+		{8.9, 1},  // Below again
+		{12.5, 1}, // Straight past the target
+		{13, 0},
+		{11, 0},   // Back inside: re-armed
+		{12.1, 1}, // Past the target again
+	} {
+		logs.Reset()
+		checkBalanceBand(step.equity, 9, 12)
+		if got := strings.Count(logs.String(), "🔔 ALERT"); got != step.alerts {
+			t.Errorf("equity %v: %d alerts, want %d\n%s", step.equity, got, step.alerts, logs)
+		}
+	}
+	if !balanceAlerts.AboveFired || balanceAlerts.BelowFired {
+		t.Errorf("final state %+v, want only the target alert fired", balanceAlerts)
+	}
+
+	logs.Reset()
+	balanceAlerts = balanceAlertState{}
+	checkBalanceBand(0.1, 0, 0)
+	checkBalanceBand(1e6, 0, 0)
+	if strings.Contains(logs.String(), "ALERT") {
+		t.Errorf("alerted with both sides off:\n%s", logs)
+	}
+}
+
+// --- Symbol Deny Patterns ---
+
+func TestDeniedSymbolPattern(t *testing.T) {
+	compiled, err := compileDenyPatterns([]string{`(?i)^test`, `(?i)rug`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := symbolDenyRegexps
+	symbolDenyRegexps = compiled
+	t.Cleanup(func() { symbolDenyRegexps = saved })
+
+	for _, tc := range []struct {
+		token Token
+		want  string
+	}{
+		{Token{Symbol: "TESTCOIN", Name: "Fine"}, `(?i)^test`},
+		{Token{Symbol: "FINE", Name: "Big Rug Energy"}, `(?i)rug`},
+		{Token{Symbol: "MYTEST", Name: "Fine"}, ""}, // Anchored: only a leading "test" matches
+		{Token{Symbol: "BONK", Name: "Bonk"}, ""},
+	} {
+		got := ""
+		if re := deniedSymbolPattern(tc.token); re != nil {
+			got = re.String()
+		}
+		if got != tc.want {
+			t.Errorf("%s/%q matched %q, want %q", tc.token.Symbol, tc.token.Name, got, tc.want)
+		}
+	}
+
+	if _, err := compileDenyPatterns([]string{`(unclosed`}); err == nil {
+		t.Error("an invalid pattern compiled without error")
+	}
+}
+
+// --- Skip Diagnostics ---
+
+func TestSkipsRecordEachPairsGate(t *testing.T) {
+	dir := newTestBot(t)
+	diagnoseSkips = true
+	t.Cleanup(func() { diagnoseSkips = defaultDiagnoseSkips })
+
+	usdc := testPair("USDCQ", 0.001)
+	usdc.QuoteToken = Token{Address: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Symbol: "USDC"}
+	thin := testPair("THIN", 0.001)
+	thin.Liquidity.Usd = flexFloat(minLiquidityUSD / 2)
+	quiet := testPair("QUIET", 0.001)
+	quiet.Volume.M5 = flexFloat(minVolume5mUSD / 2)
+	good := testPair("GOOD", 0.001)
+	scanAt(testStart, []Pair{usdc, thin, quiet, good})
+
+	skips, err := readRunLog[SkipRecord](dir, skipsLogFile, skipsLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gates := map[string]string{}
+	for _, s := range skips {
+		if s.Cycle != 1 || s.Detail == "" {
+			t.Errorf("skip %+v: want cycle 1 and a detail", s)
+		}
+		gates[s.Symbol] = s.Gate
+	}
+	// GOOD passes every filter; alone in its batch it scores under the entry threshold
+	want := map[string]string{"USDCQ": "not_sol_quoted", "THIN": "low_liquidity", "QUIET": "low_volume", "GOOD": "below_score"}
+	if !reflect.DeepEqual(gates, want) {
+		t.Errorf("skipped gates %v, want %v", gates, want)
+	}
+}
+
+// --- Signals Only ---
+
+func TestSignalsOnlyEmitsBuyAndSellWithoutTrading(t *testing.T) {
+	dir := newTestBot(t)
+	signalsOnly = true
+	balance := wallet.SOLBalance
+
+	openTestPosition(t, "SIG", 1)
+	scanAt(testStart.Add(time.Minute), []Pair{testPair("SIG", 1.01)}) // Holding, no exit due
+	scanAt(testStart.Add(2*time.Minute), []Pair{testPair("SIG", 1-hardStopLossPercent-0.02)})
+
+	signals, err := readRunLog[Signal](dir, signalsLogFile, signalsLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range signals {
+		got = append(got, s.Action+" "+s.Symbol)
+		if s.Action == "SELL" && (s.Partial || s.TokenAmount <= 0) {
+			t.Errorf("SELL signal %+v: want the whole position", s)
+		}
+	}
+	if want := []string{"BUY SIG", "SELL SIG"}; !slices.Equal(got, want) {
+		t.Errorf("signals %v, want %v", got, want)
+	}
+	if holding.Active {
+		t.Error("tracked position still open after its SELL signal")
+	}
+	if wallet.SOLBalance != balance {
+		t.Errorf("wallet balance moved from %g to %g; signals-only must not trade", balance, wallet.SOLBalance)
+	}
+	if trades := loggedTrades(t, dir); len(trades) != 0 {
+		t.Errorf("%d trades logged in signals-only, want none", len(trades))
+	}
+}
+
+// --- Entry Confirmation ---
+
+// A batch in which sym is the clear top candidate, well above the entry threshold
+func topCandidateBatch(sym string, price float64) []Pair {
+	return append([]Pair{testPair(sym, price)}, benchPairs(5, 0, benchSOLPriceUSD)...)
+}
+
+func TestUptickGateWaitsOutADowntick(t *testing.T) {
+	newTestBot(t)
+	requireLocalUptick = true
+	t.Cleanup(func() { requireLocalUptick = defaultRequireLocalUptick })
+
+	for i, price := range []float64{0.0010, 0.00099} { // First sample, then a downtick
+		scanAt(testStart.Add(time.Duration(i)*refreshInterval), topCandidateBatch("TICK", price))
+		if top := scanState.Status().Candidates[0]; top.BaseTokenSymbol != "TICK" || top.Score < entryThreshold() {
+			t.Fatalf("cycle %d: top candidate %s scores %.4f; the fixture needs TICK above %.4f", i+1, top.BaseTokenSymbol, top.Score, entryThreshold())
+		}
+		if holding.Active {
+			t.Fatalf("cycle %d: bought %s without a local uptick", i+1, holding.BaseTokenSymbol)
+		}
+	}
+	scanAt(testStart.Add(2*refreshInterval), topCandidateBatch("TICK", 0.00101))
+	if !holding.Active || holding.BaseTokenSymbol != "TICK" {
+		t.Errorf("no entry once TICK ticked up (holding %+v)", holding)
+	}
+}
+
+func TestThinBatchBoundary(t *testing.T) {
+	newTestBot(t)
+	full := topCandidateBatch("THIN", 0.001)
+	minCandidatesForEntry = len(full)
+	t.Cleanup(func() { minCandidatesForEntry = defaultMinCandidatesForEntry })
+
+	scanAt(testStart, full[:len(full)-1]) // One short
+	if top := scanState.Status().Candidates[0]; top.Score < entryThreshold() {
+		t.Fatalf("top candidate scores %.4f; the fixture needs it above %.4f", top.Score, entryThreshold())
+	}
+	if holding.Active {
+		t.Fatalf("entered with %d candidates, below the minimum of %d", len(full)-1, minCandidatesForEntry)
+	}
+	scanAt(testStart.Add(refreshInterval), full) // Exactly the minimum
+	if !holding.Active {
+		t.Errorf("no entry with exactly %d candidates", minCandidatesForEntry)
+	}
+}
+
+func TestPullbackEntryReady(t *testing.T) {
+	series := func(prices ...float64) []pairSample {
+		samples := make([]pairSample, len(prices))
+		for i, p := range prices {
+			samples[i] = pairSample{PriceNative: p}
+		}
+		return samples
+	}
+	uptrend := TokenInfo{PriceChangeH1: pullbackMinH1ChangePercent + 10}
+	for _, tc := range []struct {
+		name    string
+		c       TokenInfo
+		samples []pairSample
+		ready   bool
+	}{
+		{"dip in an uptrend", uptrend, series(1.00, 0.99, 0.98), true},
+		{"still ripping", uptrend, series(1.00, 1.02, 1.05), false},
+		{"flat", uptrend, series(1.00, 1.00, 1.00), false}, // Not even the minimum dip
+		{"falling knife", uptrend, series(1.00, 0.95, 0.90), false},
+		{"no uptrend", TokenInfo{PriceChangeH1: 5}, series(1.00, 0.99, 0.98), false},
+		{"too little history", uptrend, series(1.00, 0.98), false},
+	} {
+		if ready, detail := pullbackEntryReady(tc.c, tc.samples, "pullback"); ready != tc.ready || detail == "" {
+			t.Errorf("%s: ready %t (%q), want %t with a detail", tc.name, ready, detail, tc.ready)
+		}
+		if ready, _ := pullbackEntryReady(tc.c, tc.samples, "momentum"); !ready {
+			t.Errorf("%s: momentum style held back by the pullback check", tc.name)
+		}
+	}
+}
+
+func TestLowVolatilityGateRejectsFlatPairs(t *testing.T) {
+	flat := make([]pairSample, volatilityWindowSamples)
+	for i := range flat {
+		flat[i] = pairSample{PriceNative: 1}
+	}
+	if vol, ok := realizedVolatilityPercent(flat, volatilityWindowSamples); !ok || vol != 0 {
+		t.Errorf("flat series volatility %g (ok %t), want 0", vol, ok)
+	}
+	// Returns of +1%, -0.990%, +1%: sample stddev 1.1490
+	swings := []pairSample{{PriceNative: 1}, {PriceNative: 1.01}, {PriceNative: 1}, {PriceNative: 1.01}}
+	if vol, ok := realizedVolatilityPercent(swings, 4); !ok || math.Abs(vol-1.1490) > 1e-4 {
+		t.Errorf("swinging series volatility %g (ok %t), want ~1.149", vol, ok)
+	}
+	if _, ok := realizedVolatilityPercent(swings[:2], 4); ok {
+		t.Error("volatility reported from fewer samples than the window")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		price func(i int) float64
+		entry bool
+	}{
+		{"flat", func(i int) float64 { return 0.001 * (1 + 0.0001*float64(i)) }, false}, // Drifting just enough not to go stale
+		{"swinging", func(i int) float64 { return 0.001 * (1 + 0.03*float64(i%2)) }, true},
+	} {
+		newTestBot(t)
+		minRealizedVolatilityPercent = 1
+		t.Cleanup(func() { minRealizedVolatilityPercent = defaultMinRealizedVolatilityPercent })
+		for i := range volatilityWindowSamples {
+			if holding.Active {
+				t.Fatalf("%s: entered after %d samples, before the volatility window filled", tc.name, i)
+			}
+			scanAt(testStart.Add(time.Duration(i)*refreshInterval), topCandidateBatch("VOL", tc.price(i)))
+		}
+		if top := scanState.Status().Candidates[0]; top.BaseTokenSymbol != "VOL" || top.Score < entryThreshold() {
+			t.Fatalf("%s: top candidate %s scores %.4f; the fixture needs VOL above the threshold", tc.name, top.BaseTokenSymbol, top.Score)
+		}
+		if holding.Active != tc.entry {
+			t.Errorf("%s: entered %t, want %t", tc.name, holding.Active, tc.entry)
+		}
+	}
+}
+
+// --- Panic Close ---
+
+func TestPanicCloseEndpointFlattensAndHalts(t *testing.T) {
+	dir := newTestBot(t)
+	configured := adminToken
+	adminToken = "test-token"
+	t.Cleanup(func() { adminToken = configured; halt = nil })
+	srv := httptest.NewServer(statusMux())
+	t.Cleanup(srv.Close)
+	openTestPosition(t, "PANIC", 1)
+
+	post := func(token string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/panic-close", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := post("wrong"); code != http.StatusUnauthorized || !holding.Active {
+		t.Fatalf("unauthenticated panic close: status %d, position open %t; want 401 and untouched", code, holding.Active)
+	}
+	code, body := post(adminToken)
+	if code != http.StatusOK || !strings.Contains(body, "closed 1 position(s)") {
+		t.Fatalf("panic close answered %d %q", code, body)
+	}
+	trades := loggedTrades(t, dir)
+	if holding.Active || len(trades) != 2 || trades[1].Reason != panicCloseReason {
+		t.Fatalf("position not flattened (active %t, trades %+v)", holding.Active, trades)
+	}
+	if want := 1 - panicCloseSlippagePercent; math.Abs(trades[1].PriceNative-want) > 1e-12 {
+		t.Errorf("sold at %g, want the last price less the panic slippage (%g)", trades[1].PriceNative, want)
+	}
+
+	scanAt(testStart.Add(refreshInterval), topCandidateBatch("NEXT", 0.001))
+	if holding.Active || len(loggedTrades(t, dir)) != 2 {
+		t.Errorf("entered %s after a panic close; entries should stay halted", holding.BaseTokenSymbol)
+	}
+}
+
+// --- Equity Curve ---
+
+func TestEquityCSVRoundTripsExactly(t *testing.T) {
+	points := equityCurve([]WalletLogEntry{
+		{Timestamp: testStart, SOLBalance: 10}, // Logged before equitySOL existed
+		{Timestamp: testStart.Add(1500 * time.Millisecond), SOLBalance: 0.1 + 0.2, EquitySOL: 9.300000000000001,
+			Holding: CurrentHolding{Active: true, AmountToken: 3, LastPriceNative: 1.0 / 3}},
+		{Timestamp: testStart.Add(time.Hour + time.Nanosecond), SOLBalance: 12345.678901234567, EquitySOL: 12345.678901234567},
+		{Timestamp: testStart.Add(2 * time.Hour), SOLBalance: 1e-9, EquitySOL: 1e-9},
+	})
+	if points[0].EquitySOL != 10 || points[1].PositionSOL != 3*(1.0/3) || points[2].PositionSOL != 0 {
+		t.Fatalf("equity curve %+v: want legacy equity from the balance, a position only while held", points)
+	}
+
+	var buf bytes.Buffer
+	if err := writeEquityCSV(&buf, points); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(points)+1 || !slices.Equal(rows[0], []string{"timestamp", "balance_sol", "position_sol", "equity_sol"}) {
+		t.Fatalf("CSV rows %q, want a header and one row per point", rows)
+	}
+	for i, row := range rows[1:] {
+		p := points[i]
+		at, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil || !at.Equal(p.Time) {
+			t.Errorf("row %d: timestamp %q (%v), want %v", i+1, row[0], err, p.Time)
+		}
+		for j, want := range []float64{p.BalanceSOL, p.PositionSOL, p.EquitySOL} {
+			if got, err := strconv.ParseFloat(row[j+1], 64); err != nil || got != want {
+				t.Errorf("row %d, %s: %q parses to %v (%v), want exactly %v", i+1, rows[0][j+1], row[j+1], got, err, want)
+			}
+		}
+	}
+}
+
+func TestEquityChartEdgeSizes(t *testing.T) {
+	rising := []float64{9, 9.5, 10, 10.5, 11, 11.5, 12}
+	for _, c := range []struct {
+		name          string
+		values        []float64
+		width, height int
+		wantColumns   int
+	}{
+		{"one column", rising, 1, 5, 1},
+		{"one row", rising, 10, 1, len(rising)},
+		{"one cell", rising, 1, 1, 1},
+		{"flat series", []float64{10, 10, 10, 10}, 10, 5, 4},
+		{"bucketed", rising, 3, 4, 3},
+		{"single value", []float64{10}, 5, 3, 1},
+	} {
+		lines := renderEquityChart(c.values, c.width, c.height)
+		if len(lines) != c.height+1 {
+			t.Errorf("%s: %d lines, want %d rows and an axis", c.name, len(lines), c.height+1)
+			continue
+		}
+		dots := make([]int, c.wantColumns) // Per column
+		for r, line := range lines[:c.height] {
+			_, cells, ok := strings.Cut(line, "┤")
+			if !ok || utf8.RuneCountInString(cells) != c.wantColumns {
+				t.Fatalf("%s: row %d %q, want %d columns after the axis", c.name, r, line, c.wantColumns)
+			}
+			for col, cell := range []rune(cells) {
+				if cell == '•' {
+					dots[col]++
+					if c.name == "flat series" && r != c.height/2 {
+						t.Errorf("flat series plotted on row %d, want the middle row %d", r, c.height/2)
+					}
+				}
+			}
+		}
+		for col, n := range dots {
+			if n != 1 {
+				t.Errorf("%s: column %d has %d points, want 1\n%s", c.name, col, n, strings.Join(lines, "\n"))
+			}
+		}
+	}
+
+	if lines := renderEquityChart(rising, 3, 4); !strings.HasSuffix(lines[0], "•") {
+		t.Errorf("bucketed chart's last column (the final value, 12) not on the top row:\n%s", strings.Join(lines, "\n"))
+	}
+	for _, size := range [][2]int{{0, 5}, {5, 0}} {
+		if lines := renderEquityChart(rising, size[0], size[1]); lines != nil {
+			t.Errorf("%dx%d chart rendered %q, want nothing", size[0], size[1], lines)
+		}
+	}
+}
+
+func TestEquitySummaryFromZeroEquity(t *testing.T) {
+	points := []equityPoint{{Time: testStart, EquitySOL: 10}, {Time: testStart.Add(time.Hour), EquitySOL: 11}}
+	if got := equitySummary(points); !strings.HasSuffix(got, "(+10.00%)") {
+		t.Errorf("summary %q, want a +10.00%% change", got)
+	}
+	points[0].EquitySOL = 0
+	if got := equitySummary(points); !strings.HasSuffix(got, "(n/a)") {
+		t.Errorf("summary from zero equity %q, want the change as n/a", got)
+	}
+}
+
+// --- Reset ---
+
+func TestResetArchivesLogsAndSetsBalance(t *testing.T) {
+	dir := newTestBot(t)
+	backtesting = false // reset refuses backtests
+	t.Cleanup(func() { backtesting = true })
+	openTestPosition(t, "OLD", 1)
+	trades, err := os.ReadFile(tradesLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runReset([]string{"--balance", "25"})
+
+	archived := filepath.Join(dir, resetArchiveDir, testStart.Format("20060102-150405"))
+	for _, f := range []string{tradesLogFile, walletLogFile} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s still in place after reset (%v)", f, err)
+		}
+		if _, err := os.Stat(filepath.Join(archived, f)); err != nil {
+			t.Errorf("%s not archived: %v", f, err)
+		}
+	}
+	if got, err := os.ReadFile(filepath.Join(archived, tradesLogFile)); err != nil || !bytes.Equal(got, trades) {
+		t.Errorf("archived trades differ from the run's (%v)", err)
+	}
+
+	initPaperTrading() // The next run
+	if wallet.SOLBalance != 25 || wallet.InitialSOL != 25 || holding.Active || wallet.TradesMade != 0 {
+		t.Errorf("after reset: balance %g (initial %g), holding %t, %d trades; want a fresh 25 SOL run",
+			wallet.SOLBalance, wallet.InitialSOL, holding.Active, wallet.TradesMade)
+	}
+}
+
+// --- Scout Watchlist ---
+
+func TestScoutsStaySeparateFromCandidates(t *testing.T) {
+	tradable := topCandidateBatch("TOP", 0.001)
+	nearLiquidity := testPair("NEARLIQ", 0.001)
+	nearLiquidity.Liquidity.Usd = flexFloat(minLiquidityUSD * 0.75)
+	nearVolume := testPair("NEARVOL", 0.001)
+	nearVolume.Volume.M5 = flexFloat(minVolume5mUSD * 0.75)
+	dead := testPair("DEAD", 0.001)
+	dead.Liquidity.Usd = flexFloat(scoutMinLiquidityUSD / 2)
+
+	newTestBot(t)
+	monitorOnly = true // Scoring only
+	scanAt(testStart, tradable)
+	alone := scanState.Status().Candidates
+
+	newTestBot(t)
+	monitorOnly, scoutWatchlist = true, true
+	t.Cleanup(func() { scoutWatchlist = defaultScoutWatchlist })
+	scanAt(testStart, append(slices.Clone(tradable), nearLiquidity, nearVolume, dead))
+
+	var scouts []string
+	for _, w := range scanState.Watchlist() {
+		scouts = append(scouts, w.BaseTokenSymbol+":"+w.FailedGate)
+	}
+	slices.Sort(scouts)
+	if want := []string{"NEARLIQ:low_liquidity", "NEARVOL:low_volume"}; !slices.Equal(scouts, want) {
+		t.Errorf("watchlist %v, want %v", scouts, want)
+	}
+	candidates := scanState.Status().Candidates
+	if len(candidates) != len(alone) {
+		t.Fatalf("%d candidates with scouts around, %d without; scouts must not become candidates", len(candidates), len(alone))
+	}
+	for i := range candidates {
+		if candidates[i].PairAddress != alone[i].PairAddress || candidates[i].Score != alone[i].Score {
+			t.Errorf("candidate %d: %s %.6f with scouts, %s %.6f without; scouts must not shift normalization",
+				i, candidates[i].BaseTokenSymbol, candidates[i].Score, alone[i].BaseTokenSymbol, alone[i].Score)
+		}
+	}
+}
+
+// --- Filter Funnel ---
+
+func TestFunnelCountsEachStage(t *testing.T) {
+	dir := newTestBot(t)
+	recordFunnel, monitorOnly = true, true
+	t.Cleanup(func() { recordFunnel = defaultRecordFunnel })
+
+	batch := benchPairs(3, 0, benchSOLPriceUSD) // Pass every filter
+	usdc := testPair("USDCQ", 0.001)
+	usdc.QuoteToken = Token{Address: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Symbol: "USDC"}
+	batch = append(batch, usdc)
+	for _, sym := range []string{"THIN1", "THIN2"} {
+		p := testPair(sym, 0.001)
+		p.Liquidity.Usd = flexFloat(minLiquidityUSD / 2)
+		batch = append(batch, p)
+	}
+	quiet := testPair("QUIET", 0.001)
+	quiet.Volume.M5 = flexFloat(minVolume5mUSD / 2)
+	young := testPair("YOUNG", 0.001)
+	young.PairCreatedAt = flexInt(testStart.Add(-time.Minute).UnixMilli())
+	batch = append(batch, quiet, young)
+	scanAt(testStart, batch)
+
+	records, err := readRunLog[FunnelRecord](dir, funnelLogFile, funnelLogFile)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("funnel records %+v (%v), want one", records, err)
+	}
+	r := records[0]
+	if r.Fetched != len(batch) || r.Candidates != 3 {
+		t.Errorf("fetched %d, candidates %d; want %d, 3", r.Fetched, r.Candidates, len(batch))
+	}
+	want := map[string][2]int{ // Gate -> rejected, remaining
+		"not_sol_quoted": {1, 7},
+		"low_liquidity":  {2, 5},
+		"low_volume":     {1, 4},
+		"too_young":      {1, 3},
+	}
+	remaining := r.Fetched
+	for _, s := range r.Stages {
+		if w, ok := want[s.Gate]; ok && (s.Rejected != w[0] || s.Remaining != w[1]) {
+			t.Errorf("stage %s: rejected %d, remaining %d; want %d, %d", s.Gate, s.Rejected, s.Remaining, w[0], w[1])
+		} else if !ok && s.Rejected != 0 {
+			t.Errorf("stage %s rejected %d pairs, want none", s.Gate, s.Rejected)
+		}
+		remaining -= s.Rejected
+	}
+	if remaining != r.Candidates {
+		t.Errorf("stages leave %d pairs, but %d were scored", remaining, r.Candidates)
+	}
+	qualifying := 0
+	for _, c := range scanState.Status().Candidates {
+		if c.Score >= entryThreshold() {
+			qualifying++
+		}
+	}
+	if r.Qualifying != qualifying {
+		t.Errorf("%d qualifying in the funnel, %d among the candidates", r.Qualifying, qualifying)
+	}
+}
+
+// --- Feature Log ---
+
+func TestFeatureRecordsRoundTrip(t *testing.T) {
+	dir := newTestBot(t)
+	recordFeatures, monitorOnly = true, true
+	t.Cleanup(func() { recordFeatures = defaultRecordFeatures })
+	labeled := testPair("LBL", 0.001)
+	labeled.Labels = []string{"CLMM"}
+	scanAt(testStart, append(benchPairs(3, 0, benchSOLPriceUSD), labeled))
+
+	data, err := os.ReadFile(filepath.Join(dir, featuresLogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("%d feature records, want one per scored candidate (4):\n%s", len(lines), data)
+	}
+	for i, line := range lines {
+		var r FeatureRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("record %d: %v", i+1, err)
+		}
+		if r.Rank != i+1 || r.Candidates != 4 || r.Cycle != scanCycles || !r.Timestamp.Equal(testStart) {
+			t.Errorf("record %d: rank %d of %d, cycle %d at %v; want rank %d of 4, cycle %d at %v",
+				i+1, r.Rank, r.Candidates, r.Cycle, r.Timestamp, i+1, scanCycles, testStart)
+		}
+		if r.Symbol == "LBL" && !reflect.DeepEqual(r.Labels, labeled.Labels) {
+			t.Errorf("LBL labels %v, want %v", r.Labels, labeled.Labels)
+		}
+		sum := r.M5Change.Contribution + r.H1Change.Contribution + r.M5Volume.Contribution +
+			r.M5BuySellRatio.Contribution + r.Liquidity.Contribution
+		if r.Score == 0 || math.Abs(sum-r.Score) > 1e-9 {
+			t.Errorf("%s: embedded breakdown sums to %g, score %g", r.Symbol, sum, r.Score)
+		}
+		// Decoding and re-encoding must give back the same line: no field lost or renamed
+		again, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != line {
+			t.Errorf("record %d does not round-trip:\n got %s\nwant %s", i+1, again, line)
+		}
+	}
+}
+
+// --- Trade Rate Cap ---
+
+func TestTradeRateWindowSlides(t *testing.T) {
+	newTestBot(t)
+	maxTradesPerHour = 3
+	t.Cleanup(func() { maxTradesPerHour = defaultMaxTradesPerHour })
+	base := testStart.Truncate(time.Hour).Add(10 * time.Minute) // Entries straddle the top of the hour
+	for _, m := range []time.Duration{0, 25 * time.Minute, 50 * time.Minute} {
+		now = func() time.Time { return base.Add(m) }
+		recordEntryForRateCap()
+	}
+
+	for _, tc := range []struct {
+		at     time.Duration // After the first entry
+		capped bool
+		inWin  int
+	}{
+		{55 * time.Minute, true, 3},
+		{time.Hour - time.Second, true, 3},
+		{time.Hour, false, 2}, // The first entry is exactly an hour old: out
+		{time.Hour + 25*time.Minute, false, 1},
+		{2 * time.Hour, false, 0},
+	} {
+		now = func() time.Time { return base.Add(tc.at) }
+		checkTradeRate()
+		if tradeRateCapped != tc.capped || len(recentEntries) != tc.inWin {
+			t.Errorf("at +%v: capped %t with %d entries in the window, want %t with %d", tc.at, tradeRateCapped, len(recentEntries), tc.capped, tc.inWin)
+		}
+	}
+}
+
+// --- Strategy Profiles ---
+
+func TestProfileSwapKeepsOpenPositionsExits(t *testing.T) {
+	dir := newTestBot(t)
+	loose, tight := compiledProfile(), compiledProfile()
+	loose.HardStopLossPercent, tight.HardStopLossPercent = 0.3, 0.02
+	loose.TrailingStopLossPercent = 0.5 // Leave loose's exits to its hard stop
+	strategyProfiles, activeProfile = map[string]StrategyProfile{"loose": loose, "tight": tight}, "loose"
+	openTestPosition(t, "SWAP", 1)
+
+	if err := switchProfile("tight"); err != nil {
+		t.Fatal(err)
+	}
+	if err := switchProfile("missing"); err == nil || activeProfile != "tight" {
+		t.Fatalf("switch to an unknown profile: error %v, active %q; want an error and tight kept", err, activeProfile)
+	}
+	if holding.Profile != "loose" || holdingProfile(holding).HardStopLossPercent != 0.3 || entryProfile().HardStopLossPercent != 0.02 {
+		t.Fatalf("after the swap: position on %q (hard stop %g), entries on hard stop %g; want loose (0.3) and 0.02",
+			holding.Profile, holdingProfile(holding).HardStopLossPercent, entryProfile().HardStopLossPercent)
+	}
+
+	// Through tight's stop but well above loose's: the position rides on
+	scanAt(testStart.Add(refreshInterval), []Pair{testPair("SWAP", 0.95)})
+	if !holding.Active {
+		t.Fatalf("position opened under loose was stopped out at tight's hard stop (trades %+v)", loggedTrades(t, dir))
+	}
+	scanAt(testStart.Add(2*refreshInterval), []Pair{testPair("SWAP", 0.65)})
+	trades := loggedTrades(t, dir)
+	if holding.Active || len(trades) != 2 || !strings.HasPrefix(trades[1].Reason, "Hard Stop Loss (< 0.7") {
+		t.Fatalf("want loose's hard stop below 0.7 SOL, got active %t, trades %+v", holding.Active, trades)
+	}
+
+	// The next entry takes the active profile's exits
+	openTestPosition(t, "NEXT", 1)
+	if holding.Profile != "tight" || holdingProfile(holding).HardStopLossPercent != 0.02 {
+		t.Errorf("entry after the swap on %q (hard stop %g), want tight (0.02)", holding.Profile, holdingProfile(holding).HardStopLossPercent)
+	}
+}
+
+// --- Pool Labels ---
+
+func TestPoolLabelsAccepted(t *testing.T) {
+	clmm, dlmmV3, unlabeled := testPair("CL", 1), testPair("DL", 1), testPair("PLAIN", 1)
+	clmm.Labels, dlmmV3.Labels = []string{"CLMM"}, []string{"DLMM", "v3"}
+	for _, c := range []struct {
+		allow, deny string
+		want        []bool // clmm, dlmmV3, unlabeled
+	}{
+		{"", "", []bool{true, true, true}},
+		{"", "clmm,DLMM", []bool{false, false, true}},
+		{"clmm", "", []bool{true, false, false}},    // An allow list also excludes unlabeled pools
+		{"v3", "dlmm", []bool{false, false, false}}, // Denied wins over allowed
+		{" V3 , clmm ", "", []bool{true, true, false}},
+	} {
+		for i, p := range []Pair{clmm, dlmmV3, unlabeled} {
+			if got := poolLabelsAccepted(p.Labels, parseLabelList(c.allow), parseLabelList(c.deny)); got != c.want[i] {
+				t.Errorf("allow %q deny %q: %s %v accepted = %t, want %t", c.allow, c.deny, p.BaseToken.Symbol, p.Labels, got, c.want[i])
+			}
+		}
+	}
+}
+
+// --- Poll Jitter ---
+
+func TestJitteredIntervalBounds(t *testing.T) {
+	const base = 30 * time.Second
+	if got := jitteredInterval(base, 0); got != base {
+		t.Errorf("no jitter: %v, want %v", got, base)
+	}
+	lo, hi := base, base
+	for range 2000 {
+		d := jitteredInterval(base, 20)
+		if d < 24*time.Second || d > 36*time.Second {
+			t.Fatalf("±20%% of %v gave %v", base, d)
+		}
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	if lo > 27*time.Second || hi < 33*time.Second { // Uniform over ±6s: 2000 draws reach past ±3s
+		t.Errorf("2000 draws spanned only %v..%v, want them spread across 24s..36s", lo, hi)
+	}
+}
+
+// --- Dust Cleanup ---
+
+func TestDustRemainderClosed(t *testing.T) {
+	for _, threshold := range []float64{0, 0.05} {
+		dir := newTestBot(t)
+		dustThresholdSOL = threshold
+		t.Cleanup(func() { dustThresholdSOL = defaultDustThresholdSOL })
+
+		openTestPosition(t, "DUST", 0.001)
+		if !sellHolding(context.Background(), holding.AmountToken*0.97, 0.001, "partial") {
+			t.Fatal("partial SELL was not booked")
+		}
+		scanAt(testStart.Add(refreshInterval), []Pair{testPair("DUST", 0.001)}) // ~0.03 SOL left, price flat
+
+		trades := loggedTrades(t, dir)
+		last := trades[len(trades)-1]
+		closed := !holding.Active && strings.HasPrefix(last.Reason, "Dust Cleanup")
+		if closed != (threshold > 0) {
+			t.Errorf("threshold %v: active %t, last trade %s %q; want closed by dust cleanup only with a threshold", threshold, holding.Active, last.Action, last.Reason)
+		}
+	}
+}
+
+// --- Event Bus ---
+
+func TestEventBusDeliversAndDropsForSlowSubscribers(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	bus := &EventBus{}
+	var fast []any // Written by the fast handler only, read after Close
+	handled := make(chan struct{})
+	release := make(chan struct{})
+	slow := 0
+	bus.Subscribe("fast", func(event any) {
+		fast = append(fast, event)
+		handled <- struct{}{}
+	})
+	bus.Subscribe("slow", func(any) {
+		<-release
+		slow++
+	})
+
+	const n = eventBufferSize + 50
+	for i := range n { // One at a time, so only the stalled subscriber falls behind
+		bus.Publish(ScanCompleted{Cycle: i})
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d never reached the fast subscriber; Publish blocked on the stalled one?", i)
+		}
+	}
+	close(release)
+	bus.Close()
+
+	if len(fast) != n {
+		t.Fatalf("fast subscriber got %d of %d events", len(fast), n)
+	}
+	for i, e := range fast {
+		if e.(ScanCompleted).Cycle != i {
+			t.Fatalf("event %d is cycle %d, want in publish order", i, e.(ScanCompleted).Cycle)
+		}
+	}
+	if slow >= n || slow < eventBufferSize {
+		t.Errorf("slow subscriber handled %d of %d, want its queue's worth (%d) and the rest dropped", slow, n, eventBufferSize)
+	}
+}
+
+func TestTradesPublishEvents(t *testing.T) {
+	newTestBot(t)
+	configured := events
+	events = &EventBus{}
+	t.Cleanup(func() { events = configured })
+	var kinds []string
+	events.Subscribe("test", func(event any) { kinds = append(kinds, fmt.Sprintf("%T", event)) })
+
+	openTestPosition(t, "EVT", 0.001)
+	sellHolding(context.Background(), holding.AmountToken, 0.0011, "close")
+	events.Close()
+	want := []string{"main.TradeExecuted", "main.PositionOpened", "main.TradeExecuted", "main.PositionClosed"}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("published %v, want %v", kinds, want)
+	}
+}
+
+// --- Log Dedup ---
+
+func TestLogDeduperSuppressesAndSummarizes(t *testing.T) {
+	lines := func(buf *bytes.Buffer) []string {
+		var out []string
+		for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if l != "" {
+				out = append(out, l)
+			}
+		}
+		buf.Reset()
+		return out
+	}
+	logs := captureLog(t)
+	flags := log.Flags()
+	log.SetFlags(0)
+	t.Cleanup(func() { log.SetFlags(flags) })
+
+	d := &logDeduper{mode: "identical", runs: map[string]*dedupRun{}}
+	for range 3 {
+		d.Printf("holding", "HOLDING %s", "A")
+	}
+	d.Printf("holding", "HOLDING %s", "B") // Different text ends the run
+	d.Printf("wallet", "balance")
+	d.Flush()
+	want := []string{"HOLDING A", "🔁 …(repeated 2 times) HOLDING A", "HOLDING B", "balance"}
+	if got := lines(logs); !slices.Equal(got, want) {
+		t.Errorf("identical mode logged %q, want %q", got, want)
+	}
+
+	for range logDedupSummaryEvery + 1 {
+		d.Printf("holding", "HOLDING C")
+	}
+	want = []string{"HOLDING C", fmt.Sprintf("🔁 …(repeated %d times) HOLDING C", logDedupSummaryEvery)}
+	if got := lines(logs); !slices.Equal(got, want) {
+		t.Errorf("a long run logged %q, want %q (summarized every %d)", got, want, logDedupSummaryEvery)
+	}
+
+	d = &logDeduper{mode: "category", runs: map[string]*dedupRun{}}
+	for _, price := range []string{"1.0", "1.1", "1.2"} {
+		d.Printf("holding", "HOLDING A @ %s", price)
+	}
+	d.Flush()
+	want = []string{"HOLDING A @ 1.0", "🔁 …(repeated 2 times) HOLDING A @ 1.2"} // The latest text
+	if got := lines(logs); !slices.Equal(got, want) {
+		t.Errorf("category mode logged %q, want %q", got, want)
+	}
+
+	d = &logDeduper{runs: map[string]*dedupRun{}} // Off
+	d.Printf("holding", "HOLDING A")
+	d.Printf("holding", "HOLDING A")
+	if got := lines(logs); len(got) != 2 {
+		t.Errorf("dedup off logged %q, want both lines", got)
+	}
+}
+
+// --- Pair Age ---
+
+func TestUnknownPairAgeSkipped(t *testing.T) {
+	newTestBot(t)
+	minTime := testStart.Add(-time.Duration(minPairAgeHours * float64(time.Hour)))
+
+	var undated Pair
+	if err := json.Unmarshal([]byte(`{"pairAddress": "P", "pairCreatedAt": null}`), &undated); err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []flexInt{undated.PairCreatedAt, 0, -1} {
+		if at, known := pairCreatedTime(ms); known || !at.IsZero() {
+			t.Errorf("pairCreatedTime(%d) = %v, %t; want unknown", ms, at, known)
+		}
+	}
+
+	for _, c := range []struct {
+		name      string
+		createdAt flexInt
+		gate      string
+	}{
+		{"no timestamp", 0, "unknown_age"},
+		{"old enough", flexInt(minTime.Add(-time.Hour).UnixMilli()), ""},
+		{"too new", flexInt(minTime.Add(time.Minute).UnixMilli()), "too_young"},
+	} {
+		p := testPair("AGE", 0.001)
+		p.PairCreatedAt = c.createdAt
+		if gate, _ := pairFilterGate(p, minTime); gate != c.gate {
+			t.Errorf("%s: gate %q, want %q", c.name, gate, c.gate)
+		}
+	}
+}
+
+// --- Max Cycles ---
+
+func TestMaxCyclesRunsExactlyN(t *testing.T) {
+	newTestBot(t)
+	fetches := 0
+	fetchPairs = func(context.Context) ([]Pair, error) {
+		fetches++
+		return benchPairs(3, fetches, benchSOLPriceUSD), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // Fails the count below instead of hanging
+	defer cancel()
+	runLive(ctx, 3, func() time.Duration { return time.Millisecond })
+	if fetches != 3 || scanCycles != 3 {
+		t.Errorf("-max-cycles 3 ran %d scans (%d fetches), want exactly 3", scanCycles, fetches)
+	}
+}
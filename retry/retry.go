@@ -0,0 +1,103 @@
+// Package retry runs an operation until it succeeds, backing off exponentially (with
+// optional full jitter) between attempts, within attempt, elapsed-time and context bounds.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy bounds a retry loop. The zero value retries every error forever with no delay;
+// set at least BaseDelay and one of MaxAttempts / MaxElapsed.
+type Policy struct {
+	BaseDelay   time.Duration // Backoff before the 2nd attempt
+	MaxDelay    time.Duration // Cap on any single backoff (0 = none)
+	Multiplier  float64       // Backoff growth per attempt (<= 1 means 2)
+	Jitter      bool          // Full jitter: sleep a uniform random duration in [0, backoff]
+	MaxAttempts int           // Total attempts, including the first (0 = unlimited)
+	MaxElapsed  time.Duration // Give up rather than start a backoff that would end past this (0 = none)
+
+	// Retryable classifies an error; nil treats every error as retryable. Errors wrapped
+	// with Permanent are never retried either way.
+	Retryable func(error) bool
+	// OnRetry, if set, is called before each backoff, e.g. to log the failure
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// Delay is the backoff after the given failed attempt (1-based): BaseDelay grown by
+// Multiplier per attempt, capped at MaxDelay, then jittered if Jitter is set.
+func (p Policy) Delay(attempt int) time.Duration {
+	mult := p.Multiplier
+	if mult <= 1 {
+		mult = 2
+	}
+	backoff := float64(p.BaseDelay) * math.Pow(mult, float64(max(attempt-1, 0)))
+	if p.MaxDelay > 0 && backoff > float64(p.MaxDelay) {
+		backoff = float64(p.MaxDelay)
+	}
+	// Clamp before converting: without MaxDelay the backoff grows unbounded, and
+	// float64(MaxInt64) is 2^63, one past the largest int64
+	d := time.Duration(math.MaxInt64)
+	if backoff < float64(math.MaxInt64) {
+		d = time.Duration(backoff)
+	}
+	if p.Jitter {
+		return time.Duration(rand.Uint64N(uint64(d) + 1))
+	}
+	return d
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; Do returns it (unwrapped) straight away
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Do calls fn until it returns nil or the policy gives up, and returns fn's last error.
+// If ctx is cancelled during a backoff, Do returns at once with an error wrapping both
+// ctx.Err() and the last failure.
+func Do(ctx context.Context, p Policy, fn func(context.Context) error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if ctx.Err() != nil || (p.Retryable != nil && !p.Retryable(err)) {
+			return err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return err
+		}
+		delay := p.Delay(attempt)
+		if p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed {
+			return err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky")
+
+func TestDelay(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{
+		0: 100 * time.Millisecond, // Treated as the first attempt
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second, // Capped
+		9: time.Second,
+	} {
+		if got := p.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	p.Multiplier = 3
+	if got := p.Delay(3); got != 900*time.Millisecond {
+		t.Errorf("Delay(3) with Multiplier 3 = %v, want 900ms", got)
+	}
+}
+
+func TestDelayOverflow(t *testing.T) {
+	p := Policy{BaseDelay: time.Second}
+	for _, attempt := range []int{63, 64, 100, 10_000} {
+		if got := p.Delay(attempt); got != math.MaxInt64 {
+			t.Errorf("Delay(%d) without MaxDelay = %v, want the largest Duration", attempt, got)
+		}
+	}
+	p.Jitter = true
+	for range 100 {
+		if got := p.Delay(10_000); got < 0 {
+			t.Fatalf("jittered Delay overflowed to %v", got)
+		}
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: true}
+	for attempt := 1; attempt <= 8; attempt++ {
+		bound := min(100*time.Millisecond<<(attempt-1), time.Second)
+		for range 200 {
+			if got := p.Delay(attempt); got < 0 || got > bound {
+				t.Fatalf("Delay(%d) = %v, outside [0, %v]", attempt, got, bound)
+			}
+		}
+	}
+}
+
+func TestDoMaxAttempts(t *testing.T) {
+	calls := 0
+	var retries []int
+	p := Policy{BaseDelay: time.Microsecond, MaxAttempts: 4, OnRetry: func(attempt int, err error, _ time.Duration) {
+		retries = append(retries, attempt)
+	}}
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, errFlaky) || calls != 4 || len(retries) != 3 {
+		t.Errorf("got err %v after %d calls and retries %v, want errFlaky after 4 calls and 3 retries", err, calls, retries)
+	}
+}
+
+func TestDoSucceedsAfterFailures(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{BaseDelay: time.Microsecond, MaxAttempts: 5}, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got err %v after %d calls, want success on the 3rd", err, calls)
+	}
+}
+
+func TestDoMaxElapsed(t *testing.T) {
+	// Attempts start at ~0, 20 and 60ms; the 3rd backoff (80ms) would end past MaxElapsed,
+	// so Do gives up after 3 attempts instead of sleeping into it
+	p := Policy{BaseDelay: 20 * time.Millisecond, MaxElapsed: 100 * time.Millisecond}
+	calls := 0
+	start := time.Now()
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, errFlaky) || calls != 3 {
+		t.Errorf("got err %v after %d calls, want errFlaky after 3", err, calls)
+	}
+	if elapsed := time.Since(start); elapsed > p.MaxElapsed {
+		t.Errorf("Do ran %v, past MaxElapsed %v", elapsed, p.MaxElapsed)
+	}
+}
+
+func TestDoPermanent(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{BaseDelay: time.Microsecond}, func(context.Context) error {
+		calls++
+		return Permanent(errFlaky)
+	})
+	if err != errFlaky || calls != 1 {
+		t.Errorf("got err %v after %d calls, want the unwrapped error after 1", err, calls)
+	}
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+}
+
+func TestDoNotRetryable(t *testing.T) {
+	calls := 0
+	p := Policy{BaseDelay: time.Microsecond, Retryable: func(err error) bool { return !errors.Is(err, errFlaky) }}
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, errFlaky) || calls != 1 {
+		t.Errorf("got err %v after %d calls, want errFlaky after 1", err, calls)
+	}
+}
+
+func TestDoContextCancelledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{BaseDelay: time.Hour, OnRetry: func(int, error, time.Duration) { cancel() }}
+	calls := 0
+	start := time.Now()
+	err := Do(ctx, p, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errFlaky) {
+		t.Errorf("got %v, want an error wrapping both context.Canceled and the last failure", err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do took %v to notice the cancellation", elapsed)
+	}
+}
@@ -1,6 +1,7 @@
 CREATE TABLE pair_snapshots (
     timestamp TIMESTAMPTZ NOT NULL,     -- Time of the snapshot
-    pair_address TEXT NOT NULL,        -- Solana address of the liquidity pool
+    chain_id TEXT NOT NULL,            -- DexScreener chain ID (solana, base, ethereum, ...)
+    pair_address TEXT NOT NULL,        -- Address of the liquidity pool on that chain
     base_token_address TEXT NOT NULL,
     base_token_symbol TEXT,
     quote_token_address TEXT NOT NULL,
@@ -23,13 +24,31 @@ CREATE TABLE pair_snapshots (
     pair_created_at TIMESTAMPTZ,      -- Timestamp when the pair was created
 
     -- Composite Primary Key ensures uniqueness per pair per timestamp
-    PRIMARY KEY (timestamp, pair_address)
+    PRIMARY KEY (timestamp, chain_id, pair_address)
 );
 
 -- Create an index for efficient time-based queries (Crucial!)
 CREATE INDEX idx_pair_snapshots_timestamp ON pair_snapshots (timestamp DESC);
 -- Optional index for querying specific pairs over time
 CREATE INDEX idx_pair_snapshots_pair_timestamp ON pair_snapshots (pair_address, timestamp DESC);
+-- Per-chain pair history
+CREATE INDEX idx_pair_snapshots_chain_pair_timestamp ON pair_snapshots (chain_id, pair_address, timestamp DESC);
 
--- Optional: Hypertable for TimescaleDB later
--- SELECT create_hypertable('pair_snapshots', 'timestamp');
\ No newline at end of file
+-- Migrating a table created before chain_id existed (all earlier rows are Solana):
+-- ALTER TABLE pair_snapshots ADD COLUMN chain_id TEXT NOT NULL DEFAULT 'solana';
+-- ALTER TABLE pair_snapshots ALTER COLUMN chain_id DROP DEFAULT;
+-- ALTER TABLE pair_snapshots DROP CONSTRAINT pair_snapshots_pkey, ADD PRIMARY KEY (timestamp, chain_id, pair_address);
+-- CREATE INDEX idx_pair_snapshots_chain_pair_timestamp ON pair_snapshots (chain_id, pair_address, timestamp DESC);
+
+-- The collector creates all of the above itself on startup (IF NOT EXISTS).
+--
+-- TimescaleDB: run the collector with -timescale and, if the timescaledb extension is
+-- installed in this database, pair_snapshots becomes a hypertable partitioned on
+-- timestamp (1-day chunks). Without the extension it falls back to the plain table and
+-- logs that. Differences to be aware of with a hypertable:
+--   * Existing rows are migrated into chunks on first conversion, locking the table.
+--   * Unique constraints must include timestamp (the primary key above already does).
+--   * Time-bounded queries only touch matching chunks, and retention can use
+--     drop_chunks / add_retention_policy instead of DELETE.
+-- Equivalent manual step:
+-- SELECT create_hypertable('pair_snapshots', 'timestamp', chunk_time_interval => INTERVAL '1 day', if_not_exists => TRUE, migrate_data => TRUE);
\ No newline at end of file
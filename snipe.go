@@ -3,49 +3,44 @@ package main
 
 import (
 	"sort"
-//	"io"
-//	"context"
+	//	"io"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
-//	"github.com/gagliardetto/solana-go/rpc"
-)
+	//	"github.com/gagliardetto/solana-go/rpc"
 
-// helper to parse float values safely
-func entryFloat(val interface{}) float64 {
-	if v, ok := val.(float64); ok {
-		return v
-	}
-	return 0
-}
+	"pumpfun/retry"
+)
 
 // TokenListing represents a token listed on Pump.fun
 // Includes historical prices for momentum tracking
 type TokenListing struct {
-	Name       string  `json:"name"`
-	Address    string  `json:"address"`
-	Liquidity  float64 `json:"liquidity"`
-	Price      float64 `json:"price"`
-	CreatedAt  int64   `json:"created_at"`
-	PrevPrice  float64 `json:"-"`
-	Momentum   float64 `json:"-"`
+	Name      string  `json:"name"`
+	Address   string  `json:"address"`
+	Liquidity float64 `json:"liquidity"`
+	Price     float64 `json:"price"`
+	CreatedAt int64   `json:"created_at"`
+	PrevPrice float64 `json:"-"`
+	Momentum  float64 `json:"-"`
 }
 
 // TradeLog holds simulated trade data
 type TradeLog struct {
-	Timestamp     string  `json:"timestamp"`
-	TokenName     string  `json:"token_name"`
-	TokenAddress  string  `json:"token_address"`
-	AmountSOL     float64 `json:"amount_sol"`
-	ExpectedOut   float64 `json:"expected_amount"`
-	Slippage      float64 `json:"slippage"`
-	FeeEstimate   float64 `json:"fee_estimate_sol"`
+	Timestamp    string  `json:"timestamp"`
+	TokenName    string  `json:"token_name"`
+	TokenAddress string  `json:"token_address"`
+	AmountSOL    float64 `json:"amount_sol"`
+	ExpectedOut  float64 `json:"expected_amount"`
+	Slippage     float64 `json:"slippage"`
+	FeeEstimate  float64 `json:"fee_estimate_sol"`
 }
 
 // WalletLog holds balance snapshot data
@@ -55,49 +50,182 @@ type WalletLog struct {
 	Token     float64 `json:"token_estimate"`
 }
 
+// Entry in the Jupiter token list (only the fields we use)
+type JupiterToken struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// Jupiter v6 /quote response. Amounts are integer strings in the mint's base units.
+type JupiterQuote struct {
+	InputMint            string                 `json:"inputMint"`
+	InAmount             string                 `json:"inAmount"`
+	OutputMint           string                 `json:"outputMint"`
+	OutAmount            string                 `json:"outAmount"`
+	OtherAmountThreshold string                 `json:"otherAmountThreshold"` // Minimum out after slippage (ExactIn)
+	SwapMode             string                 `json:"swapMode"`
+	SlippageBps          int                    `json:"slippageBps"`
+	PriceImpactPct       string                 `json:"priceImpactPct"` // Fraction as a decimal string, e.g. "0.0012"
+	RoutePlan            []JupiterRoutePlanStep `json:"routePlan"`
+	ContextSlot          uint64                 `json:"contextSlot"`
+	TimeTaken            float64                `json:"timeTaken"`
+}
+
+type JupiterRoutePlanStep struct {
+	SwapInfo JupiterSwapInfo `json:"swapInfo"`
+	Percent  int             `json:"percent"`
+}
+
+type JupiterSwapInfo struct {
+	AmmKey     string `json:"ammKey"`
+	Label      string `json:"label"` // DEX name, e.g. "Raydium"
+	InputMint  string `json:"inputMint"`
+	OutputMint string `json:"outputMint"`
+	InAmount   string `json:"inAmount"`
+	OutAmount  string `json:"outAmount"`
+	FeeAmount  string `json:"feeAmount"`
+	FeeMint    string `json:"feeMint"`
+}
+
+// Quoted output in base units
+func (q JupiterQuote) Out() (uint64, error) {
+	return parseBaseUnits("outAmount", q.OutAmount)
+}
+
+// Minimum output after slippage, in base units
+func (q JupiterQuote) MinOut() (uint64, error) {
+	return parseBaseUnits("otherAmountThreshold", q.OtherAmountThreshold)
+}
+
+// Price impact as a fraction (0.01 = 1%)
+func (q JupiterQuote) PriceImpact() (float64, error) {
+	v, err := strconv.ParseFloat(q.PriceImpactPct, 64)
+	if err != nil {
+		return 0, fmt.Errorf("priceImpactPct %q: %w", q.PriceImpactPct, err)
+	}
+	return v, nil
+}
+
+// DEX labels along the route, in order, e.g. [Raydium Orca]
+func (q JupiterQuote) RouteLabels() []string {
+	labels := make([]string, 0, len(q.RoutePlan))
+	for _, step := range q.RoutePlan {
+		labels = append(labels, step.SwapInfo.Label)
+	}
+	return labels
+}
+
+// Errors if the quote's price impact exceeds maxPriceImpactPct. A quote without a usable
+// priceImpactPct is rejected too, since we can't tell whether the pool can take the order.
+func checkPriceImpact(q JupiterQuote) error {
+	if maxPriceImpactPct <= 0 {
+		return nil
+	}
+	impact, err := q.PriceImpact()
+	if err != nil {
+		return err
+	}
+	if impact*100 > maxPriceImpactPct {
+		return fmt.Errorf("price impact %.2f%% exceeds %.2f%%", impact*100, maxPriceImpactPct)
+	}
+	return nil
+}
+
+func parseBaseUnits(field, v string) (uint64, error) {
+	if v == "" {
+		return 0, fmt.Errorf("response has no %s", field)
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q: %w", field, v, err)
+	}
+	return n, nil
+}
+
+// HTTP settings for the Jupiter token list and quotes
+const (
+	httpTimeout    = 15 * time.Second // Per attempt
+	fetchAttempts  = 3                // Total tries per request
+	retryBaseDelay = 1 * time.Second  // Doubled after each failed attempt, then fully jittered
+)
+
+// Entry sizing and route quality
+const (
+	wrappedSOLMint    = "So11111111111111111111111111111111111111112"
+	buyAmountLamports = 500_000_000 // 0.5 SOL
+	maxPriceImpactPct = 2.0         // Reject picks whose Jupiter quote for buyAmountLamports moves the price more than this, in percent (0 = off)
+)
+
 // Global price history cache for momentum tracking
 var priceCache = map[string]float64{}
 
-func fetchListings() ([]TokenListing, error) {
-	url := "https://cache.jup.ag/tokens"
-	resp, err := http.Get(url)
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// GETs url and decodes the JSON body into out, retrying network errors, 429s, 5xx and
+// bad bodies with exponential backoff. Other 4xx statuses fail immediately.
+func getJSON(url string, out interface{}) error {
+	policy := retry.Policy{
+		BaseDelay:   retryBaseDelay,
+		Jitter:      true,
+		MaxAttempts: fetchAttempts,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			log.Printf("⚠️ Attempt %d/%d for %s failed: %v. Retrying in %v", attempt, fetchAttempts, url, err, delay.Round(time.Millisecond))
+		},
+	}
+	return retry.Do(context.Background(), policy, func(ctx context.Context) error {
+		return getJSONOnce(ctx, url, out)
+	})
+}
+
+func getJSONOnce(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, err
+		return retry.Permanent(err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("status %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return err
+		}
+		return retry.Permanent(err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
 
-	var tokens []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
-		return nil, err
+func fetchListings() ([]TokenListing, error) {
+	url := "https://cache.jup.ag/tokens"
+	var tokens []JupiterToken
+	if err := getJSON(url, &tokens); err != nil {
+		return nil, fmt.Errorf("fetching Jupiter token list: %w", err)
 	}
 
 	var listings []TokenListing
 	for _, token := range tokens {
-		address := fmt.Sprintf("%v", token["address"])
-		name := fmt.Sprintf("%v", token["name"])
+		address, name := token.Address, token.Name
 		if address == "" || name == "" || address == "So11111111111111111111111111111111111111112" {
 			continue
 		}
 
-		price := 0.0
 		quoteUrl := fmt.Sprintf("https://quote-api.jup.ag/v6/quote?inputMint=So11111111111111111111111111111111111111112&outputMint=%s&amount=10000000", address)
-		res, err := http.Get(quoteUrl)
-		if err != nil {
-			continue
-		}
-		var result map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-			res.Body.Close()
+		var quote JupiterQuote
+		if err := getJSON(quoteUrl, &quote); err != nil {
 			continue
 		}
-		res.Body.Close()
-
-		outStr, ok := result["outAmount"].(string)
-		if !ok || outStr == "" {
+		out, err := quote.Out()
+		if err != nil {
 			continue
 		}
-		fmt.Sscanf(outStr, "%f", &price)
-		price = price / 1e9
+		price := float64(out) / 1e9
 
 		prev := priceCache[address]
 		priceCache[address] = price
@@ -155,7 +283,86 @@ func logWallet(wallet WalletLog) {
 	json.NewEncoder(f).Encode(wallet)
 }
 
+// One preflight check: Run returns nil on success; Hint says what to fix on failure
+type preflightCheck struct {
+	Name string
+	Hint string
+	Run  func() (detail string, err error)
+}
+
+// Wallet file, log directory write access and the Jupiter quote API
+func preflightChecks() []preflightCheck {
+	return []preflightCheck{
+		{
+			Name: "Wallet file wallet.json",
+			Hint: "put a base58 private key (quoted) in wallet.json, or delete it and let the bot generate one",
+			Run: func() (string, error) {
+				key, err := LoadSolanaWallet()
+				if err != nil {
+					return "", err
+				}
+				return "public key " + key.PublicKey().String(), nil
+			},
+		},
+		{
+			Name: "Write access to . (trades.json, wallet_balances.json)",
+			Hint: "run from a directory this user can write to, or fix its permissions",
+			Run: func() (string, error) {
+				f, err := os.CreateTemp(".", ".preflight-*")
+				if err != nil {
+					return "", err
+				}
+				f.Close()
+				return "", os.Remove(f.Name())
+			},
+		},
+		{
+			Name: "Jupiter quote API",
+			Hint: "check network access to quote-api.jup.ag",
+			Run: func() (string, error) {
+				quoteUrl := "https://quote-api.jup.ag/v6/quote?inputMint=So11111111111111111111111111111111111111112&outputMint=EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v&amount=10000000&slippageBps=100"
+				var quote JupiterQuote
+				if err := getJSON(quoteUrl, &quote); err != nil {
+					return "", err
+				}
+				if _, err := quote.Out(); err != nil {
+					return "", err
+				}
+				return "SOL→USDC quoted via " + strings.Join(quote.RouteLabels(), " → "), nil
+			},
+		},
+	}
+}
+
+// Runs every check (a failure doesn't stop the rest), prints a pass/fail checklist and
+// returns true if all passed
+func runPreflight(checks []preflightCheck) bool {
+	passed := 0
+	for _, c := range checks {
+		detail, err := c.Run()
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n   → %s\n", c.Name, err, c.Hint)
+			continue
+		}
+		passed++
+		if detail != "" {
+			fmt.Printf("✅ %s (%s)\n", c.Name, detail)
+		} else {
+			fmt.Printf("✅ %s\n", c.Name)
+		}
+	}
+	fmt.Printf("%d/%d checks passed\n", passed, len(checks))
+	return passed == len(checks)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "preflight" {
+		if !runPreflight(preflightChecks()) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Println("🚀 Starting Pump.fun SniperBot...")
 	key, err := LoadSolanaWallet()
 	if err != nil {
@@ -170,74 +377,70 @@ func main() {
 	listings, err := fetchListings()
 	if err != nil || len(listings) == 0 {
 
-	// Sort by momentum descending
-	sort.Slice(listings, func(i, j int) bool {
-		return listings[i].Momentum > listings[j].Momentum
-	})
+		// Sort by momentum descending
+		sort.Slice(listings, func(i, j int) bool {
+			return listings[i].Momentum > listings[j].Momentum
+		})
 
-	log.Println("📊 Top 10 Momentum Tokens:")
-	for i, token := range listings {
-		if i >= 10 {
-			break
+		log.Println("📊 Top 10 Momentum Tokens:")
+		for i, token := range listings {
+			if i >= 10 {
+				break
+			}
+			log.Printf("%2d. %s | %.6f SOL | %+.2f%% momentum | %s", i+1, token.Name, token.Price, token.Momentum*100, token.Address)
 		}
-		log.Printf("%2d. %s | %.6f SOL | %+.2f%% momentum | %s", i+1, token.Name, token.Price, token.Momentum*100, token.Address)
-	}
 		log.Fatal("❌ Could not fetch live tokens")
 	}
 
-	// Find top trending token based on momentum and liquidity
+	// Find top trending token based on momentum and liquidity whose pool can absorb the order
 	var pick TokenListing
+	var quote JupiterQuote
 	for _, token := range listings {
-		if token.Liquidity > 10 && token.Momentum > 0.1 { // >10% growth
-			pick = token
-			break
+		if token.Liquidity <= 10 || token.Momentum <= 0.1 { // >10% growth
+			continue
 		}
+		quoteUrl := fmt.Sprintf("https://quote-api.jup.ag/v6/quote?inputMint=%s&outputMint=%s&amount=%d&slippage=1", wrappedSOLMint, token.Address, buyAmountLamports)
+		var q JupiterQuote
+		if err := getJSON(quoteUrl, &q); err != nil {
+			log.Printf("⚠️ Failed to get Jupiter quote for %s: %v", token.Name, err)
+			continue
+		}
+		if err := checkPriceImpact(q); err != nil {
+			log.Printf("🚫 Rejecting %s: %v", token.Name, err)
+			continue
+		}
+		pick, quote = token, q
+		break
 	}
 	if pick.Address == "" {
 		log.Println("⚠️ No strong momentum token found")
 		return
 	}
 
-	inputMint := "So11111111111111111111111111111111111111112"
-	amountLamports := 500_000_000
-	quoteUrl := fmt.Sprintf("https://quote-api.jup.ag/v6/quote?inputMint=%s&outputMint=%s&amount=%d&slippage=1", inputMint, pick.Address, amountLamports)
-	resp, err := http.Get(quoteUrl)
+	out, err := quote.Out()
 	if err != nil {
-		log.Fatalf("❌ Failed to get Jupiter quote: %v", err)
+		log.Fatalf("❌ Bad Jupiter quote: %v", err)
 	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Fatalf("❌ Jupiter decode error: %v", err)
+	outAmount := float64(out) / 1e9
+	if impact, err := quote.PriceImpact(); err == nil {
+		log.Printf("🧭 Route %v, price impact %.3f%%", quote.RouteLabels(), impact*100)
 	}
-	outStr, ok := result["outAmount"].(string)
-	if !ok {
-		log.Fatalf("❌ Missing 'outAmount' in Jupiter response")
-	}
-	var outAmount float64
-	fmt.Sscanf(outStr, "%f", &outAmount)
-	outAmount = outAmount / 1e9
 
 	slippage := 0.01
-	if slippageStr, ok := result["otherAmountThreshold"].(string); ok {
-		var threshold float64
-		fmt.Sscanf(slippageStr, "%f", &threshold)
-		threshold = threshold / 1e9
-		if threshold > 0 {
-			slippage = (threshold - outAmount) / threshold
-		}
+	if minOut, err := quote.MinOut(); err == nil && minOut > 0 {
+		threshold := float64(minOut) / 1e9
+		slippage = (threshold - outAmount) / threshold
 	}
 	timestamp := time.Now().Format(time.RFC3339)
 
 	logTrade(TradeLog{
-		Timestamp:     timestamp,
-		TokenName:     pick.Name,
-		TokenAddress:  pick.Address,
-		AmountSOL:     0.5,
-		ExpectedOut:   outAmount,
-		Slippage:      slippage,
-		FeeEstimate:   0.0005,
+		Timestamp:    timestamp,
+		TokenName:    pick.Name,
+		TokenAddress: pick.Address,
+		AmountSOL:    0.5,
+		ExpectedOut:  outAmount,
+		Slippage:     slippage,
+		FeeEstimate:  0.0005,
 	})
 
 	logWallet(WalletLog{
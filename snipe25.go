@@ -1,35 +1,67 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	// No longer need solana-go or the old price cache for this approach
 )
 
 const (
-	// DexScreener API endpoint for searching pairs
-	dexScreenerSearchAPI = "https://api.dexscreener.com/latest/dex/search"
+	// DexScreener API base and search path (override the base with -dexscreener-url or DEXSCREENER_URL)
+	defaultDexScreenerBaseURL = "https://api.dexscreener.com"
+	dexScreenerSearchPath     = "/latest/dex/search"
 	// Chain ID for Solana on DexScreener
 	solanaChainID = "solana"
 	// How often to refresh the data
 	refreshInterval = 30 * time.Second // Refresh every 60 seconds
+	// Deadline for one scan's requests
+	scanCycleTimeout = 25 * time.Second
+	// Randomize each wait by ± this % of refreshInterval so parallel bots don't poll in sync (0 = off)
+	pollJitterPercent = 0.0
 	// Number of top movers to display
 	topMoversCount = 20
 	// Minimum USD liquidity threshold to consider a pair
 	minLiquidityUSD = 1000.0
 	// Minimum 5-minute volume threshold (in USD)
 	minVolume5mUSD = 100.0
-	// Quote tokens we typically trade against (to identify the target token)
+	// Quote tokens we typically trade against (to identify the target token), matched by
+	// mint address since symbols can be spoofed: wrapped SOL, USDC, USDT
+	commonQuoteMints = "So11111111111111111111111111111111111111112,EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v,Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB"
+	// Symbol fallback: also accept these quote symbols whatever their mint (spoofable, so off by default)
+	matchQuoteSymbols  = false
 	commonQuoteSymbols = "SOL,USDC,USDT"
+	// Pool-type label filters (comma-separated, case-insensitive). Denied labels exclude a
+	// pair; a non-empty allow list requires one of its labels (unlabeled pools excluded).
+	allowedPoolLabels = ""
+	deniedPoolLabels  = ""
 )
 
+var dexScreenerBaseURL = defaultDexScreenerBaseURL
+
+// Base tokens whose symbol or name matches any of these (Go regexp syntax) are skipped,
+// e.g. `(?i)(test|scam|airdrop|claim)`. An invalid pattern stops the scanner at startup.
+var symbolDenyPatterns = []string{}
+
+var symbolDenyRegexps []*regexp.Regexp      // Compiled symbolDenyPatterns, set in main
+var loggedSymbolDenials = map[string]bool{} // PairAddress -> already reported
+
 // --- DexScreener API Response Structures ---
 
 type DexScreenerResponse struct {
@@ -39,20 +71,21 @@ type DexScreenerResponse struct {
 }
 
 type Pair struct {
-	ChainID     string      `json:"chainId"`
-	DexID       string      `json:"dexId"`
-	URL         string      `json:"url"`
-	PairAddress string      `json:"pairAddress"`
-	BaseToken   Token       `json:"baseToken"`
-	QuoteToken  Token       `json:"quoteToken"`
-	PriceNative string      `json:"priceNative"` // Price in terms of quote token
-	PriceUsd    string      `json:"priceUsd"`    // Can be null if issue fetching USD price
-	Txns        Transactions `json:"txns"`
-	Volume      Volume      `json:"volume"`
-	PriceChange PriceChange `json:"priceChange"`
-	Liquidity   Liquidity   `json:"liquidity"`
-	Fdv         float64     `json:"fdv"` // Fully diluted valuation
-	PairCreatedAt int64     `json:"pairCreatedAt"`
+	ChainID       string       `json:"chainId"`
+	DexID         string       `json:"dexId"`
+	URL           string       `json:"url"`
+	PairAddress   string       `json:"pairAddress"`
+	BaseToken     Token        `json:"baseToken"`
+	QuoteToken    Token        `json:"quoteToken"`
+	PriceNative   flexString   `json:"priceNative"` // Price in terms of quote token
+	PriceUsd      flexString   `json:"priceUsd"`    // Can be null if issue fetching USD price
+	Txns          Transactions `json:"txns"`
+	Volume        Volume       `json:"volume"`
+	PriceChange   PriceChange  `json:"priceChange"`
+	Liquidity     Liquidity    `json:"liquidity"`
+	Fdv           flexFloat    `json:"fdv"` // Fully diluted valuation
+	PairCreatedAt flexInt      `json:"pairCreatedAt"`
+	Labels        []string     `json:"labels"` // Pool type, e.g. "CLMM", "v3"; absent for standard pools
 }
 
 type Token struct {
@@ -62,63 +95,183 @@ type Token struct {
 }
 
 type Transactions struct {
-	M5 BuysSells `json:"m5"`
-	H1 BuysSells `json:"h1"`
-	H6 BuysSells `json:"h6"`
+	M5  BuysSells `json:"m5"`
+	H1  BuysSells `json:"h1"`
+	H6  BuysSells `json:"h6"`
 	H24 BuysSells `json:"h24"`
 }
 
 type BuysSells struct {
-	Buys  int `json:"buys"`
-	Sells int `json:"sells"`
+	Buys  flexInt `json:"buys"`
+	Sells flexInt `json:"sells"`
 }
 
 type Volume struct {
 	// Volume in USD
-	H24 float64 `json:"h24"`
-	H6  float64 `json:"h6"`
-	H1  float64 `json:"h1"`
-	M5  float64 `json:"m5"`
+	H24 flexFloat `json:"h24"`
+	H6  flexFloat `json:"h6"`
+	H1  flexFloat `json:"h1"`
+	M5  flexFloat `json:"m5"`
 }
 
 type PriceChange struct {
 	// Percentage change
-	M5  float64 `json:"m5"`
-	H1  float64 `json:"h1"`
-	H6  float64 `json:"h6"`
-	H24 float64 `json:"h24"`
+	M5  flexFloat `json:"m5"`
+	H1  flexFloat `json:"h1"`
+	H6  flexFloat `json:"h6"`
+	H24 flexFloat `json:"h24"`
 }
 
 type Liquidity struct {
-	Usd   float64 `json:"usd"` // Total liquidity in USD, might be null
-	Base  float64 `json:"base"`
-	Quote float64 `json:"quote"`
+	Usd   flexFloat `json:"usd"` // Total liquidity in USD, might be null
+	Base  flexFloat `json:"base"`
+	Quote flexFloat `json:"quote"`
+}
+
+// --- Lenient JSON Scalars ---
+
+// DexScreener sometimes sends null, a quoted string instead of a number (or vice
+// versa), or NaN/Inf. These types never fail to decode: anything unusable becomes
+// the zero value, which the filters already reject.
+type flexFloat float64
+type flexInt int64
+type flexString string
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	*f = flexFloat(decodeFlexNumber(data))
+	return nil
+}
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	v := decodeFlexNumber(data)
+	if v >= math.MaxInt64 || v <= math.MinInt64 {
+		v = 0 // Out of range can't be a real count or timestamp
+	}
+	*n = flexInt(v)
+	return nil
+}
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil {
+		*s = ""
+		return nil
+	}
+	switch x := v.(type) {
+	case string:
+		*s = flexString(x)
+	case float64:
+		*s = flexString(strconv.FormatFloat(x, 'f', -1, 64))
+	default:
+		*s = ""
+	}
+	return nil
+}
+
+func decodeFlexNumber(data []byte) float64 {
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil {
+		return 0
+	}
+	f := 0.0
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case string:
+		f, _ = strconv.ParseFloat(strings.TrimSpace(x), 64)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
 }
 
 // --- Enhanced Structure for Our Use ---
 
 type TokenMomentumInfo struct {
-	PairAddress     string
-	BaseTokenSymbol string
-	BaseTokenAddr   string
+	PairAddress      string
+	BaseTokenSymbol  string
+	BaseTokenAddr    string
 	QuoteTokenSymbol string
-	PriceChangeM5   float64 // 5m % change
-	VolumeM5        float64 // 5m volume in USD
-	LiquidityUSD    float64 // Current liquidity in USD
-	PriceUSD        string  // Current price in USD
-	PairURL         string
+	PriceChangeM5    float64 // 5m % change
+	VolumeM5         float64 // 5m volume in USD
+	LiquidityUSD     float64 // Current liquidity in USD
+	PriceUSD         string  // Current price in USD
+	PairURL          string
+	Labels           []string
+}
+
+// DexScreener answers in three shapes: {"pairs": [...]} (search, multi-pair lookups),
+// {"pair": {...}} (pair by address) and a bare [...] (token pairs). Returns the raw pair
+// objects from any of them; a missing or null pairs list is an empty result, not an error.
+func rawDexScreenerPairs(body []byte) ([]json.RawMessage, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("error decoding DexScreener pair array: %w", err)
+		}
+		return list, nil
+	}
+
+	var envelope struct {
+		Pairs []json.RawMessage `json:"pairs"`
+		Pair  json.RawMessage   `json:"pair"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("error decoding DexScreener JSON: %w", err)
+	}
+	if len(envelope.Pairs) > 0 {
+		return envelope.Pairs, nil
+	}
+	if len(envelope.Pair) > 0 && string(envelope.Pair) != "null" {
+		return []json.RawMessage{envelope.Pair}, nil
+	}
+	return nil, nil
+}
+
+// Builds a DexScreener URL from the configured base (-dexscreener-url / DEXSCREENER_URL).
+// The base may carry its own path prefix or query string (e.g. a caching proxy); both are kept.
+func dexScreenerURL(path string, params url.Values) (string, error) {
+	u, err := url.Parse(dexScreenerBaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid DexScreener base URL %q", dexScreenerBaseURL)
+	}
+	u = u.JoinPath(path)
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
 }
 
 // Fetches pairs from DexScreener based on a search query
-func fetchDexScreenerPairs(query string) ([]Pair, error) {
+func fetchDexScreenerPairs(ctx context.Context, query string) ([]Pair, error) {
 	// Construct the URL: search for the query term on the solana chain
 	// DexScreener search seems to implicitly filter by chain based on common terms like 'SOL'
 	// or you might filter client-side. Let's search for 'SOL' which usually brings up SOL pairs.
 	// A more specific query might be needed depending on results.
-	url := fmt.Sprintf("%s?q=%s+%s", dexScreenerSearchAPI, query, solanaChainID) // Try adding chain ID to query
-	log.Printf("⏳ Fetching DexScreener data: %s", url)
+	reqURL, err := dexScreenerURL(dexScreenerSearchPath, url.Values{"q": {query + " " + solanaChainID}}) // Try adding chain ID to query
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("⏳ Fetching DexScreener data: %s", reqURL)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building DexScreener request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching from DexScreener: %w", err)
 	}
@@ -141,36 +294,120 @@ func fetchDexScreenerPairs(query string) ([]Pair, error) {
 	}
 	// log.Printf("DEBUG: DexScreener Raw Response: %s", string(bodyBytes)) // Keep for debugging if needed
 
+	rawPairs, err := rawDexScreenerPairs(bodyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w. Body was: %s", err, string(bodyBytes))
+	}
+	if len(rawPairs) == 0 {
+		log.Println("⚠️ DexScreener response contained no pairs (or they were null).")
+		return []Pair{}, nil // Return empty slice, not an error
+	}
 
-	var apiResponse DexScreenerResponse
-	if err := json.Unmarshal(bodyBytes, &apiResponse); err != nil {
-		// Try unmarshalling into just []Pair if the top-level struct fails
-		// Sometimes APIs return just the array directly
-		var pairsDirect []Pair
-		if errDirect := json.Unmarshal(bodyBytes, &pairsDirect); errDirect == nil {
-			log.Println("ℹ️ Decoded DexScreener response as direct array.")
-			return pairsDirect, nil
+	// Decode pair by pair so one malformed entry doesn't sink the whole batch
+	pairs := make([]Pair, 0, len(rawPairs))
+	for _, rawPair := range rawPairs {
+		var p Pair
+		if err := json.Unmarshal(rawPair, &p); err != nil || p.PairAddress == "" {
+			log.Printf("⚠️ Skipping malformed pair in DexScreener response: %s", string(rawPair))
+			continue
 		}
-		// If both fail, return the original error
-		return nil, fmt.Errorf("error decoding DexScreener JSON: %w. Body was: %s", err, string(bodyBytes))
+		pairs = append(pairs, p)
 	}
 
-	if apiResponse.Pairs == nil {
-		log.Println("⚠️ DexScreener response contained no pairs array (or it was null).")
-		return []Pair{}, nil // Return empty slice, not an error
+	log.Printf("✅ Found %d pairs from DexScreener search.", len(pairs))
+	return pairs, nil
+}
+
+// base ± up to jitterPercent of it, chosen uniformly, so instances started together
+// drift apart instead of polling on the same boundary. jitterPercent 0 returns base.
+func jitteredInterval(base time.Duration, jitterPercent float64) time.Duration {
+	if jitterPercent <= 0 {
+		return base
+	}
+	offset := (rand.Float64()*2 - 1) * jitterPercent / 100 * float64(base)
+	return base + time.Duration(offset)
+}
+
+func parseLabelList(list string) map[string]bool {
+	labels := make(map[string]bool)
+	for _, l := range strings.Split(list, ",") {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" {
+			labels[l] = true
+		}
 	}
+	return labels
+}
+
+// Denied labels always reject; a non-empty allow list requires at least one of its labels
+func poolLabelsAccepted(labels []string, allowed, denied map[string]bool) bool {
+	ok := len(allowed) == 0
+	for _, l := range labels {
+		l = strings.ToLower(l)
+		if denied[l] {
+			return false
+		}
+		if allowed[l] {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func compileDenyPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symbolDenyPatterns entry %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// First deny pattern matching the token's symbol or name, or nil
+func deniedSymbolPattern(t Token) *regexp.Regexp {
+	for _, re := range symbolDenyRegexps {
+		if re.MatchString(t.Symbol) || re.MatchString(t.Name) {
+			return re
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(labels, ", ") + "]"
+}
 
-	log.Printf("✅ Found %d pairs from DexScreener search.", len(apiResponse.Pairs))
-	return apiResponse.Pairs, nil
+// Biggest 5m gain first, ties broken by liquidity (descending) then pair address so the
+// top-N list doesn't reshuffle between identical cycles
+func sortMovers(candidates []TokenMomentumInfo) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		// Handle NaN or Inf if necessary, though DexScreener data is usually clean
+		a, b := candidates[i], candidates[j]
+		if a.PriceChangeM5 != b.PriceChangeM5 {
+			return a.PriceChangeM5 > b.PriceChangeM5
+		}
+		if a.LiquidityUSD != b.LiquidityUSD {
+			return a.LiquidityUSD > b.LiquidityUSD
+		}
+		return a.PairAddress < b.PairAddress
+	})
 }
 
 // The main scanning logic, designed to be called repeatedly
-func runScan() {
+func runScan(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, scanCycleTimeout)
+	defer cancel()
+
 	log.Println("--- Starting Scan Cycle ---")
 
 	// 1. Fetch pairs from DexScreener (Searching for SOL pairs on Solana)
 	// You might need to adjust the query ("SOL", "USDC", etc.) based on what works best
-	pairs, err := fetchDexScreenerPairs("SOL")
+	pairs, err := fetchDexScreenerPairs(ctx, "SOL")
 	if err != nil {
 		log.Printf("❌ Error fetching pairs: %v. Skipping cycle.", err)
 		return // Skip rest of the cycle on error
@@ -183,12 +420,19 @@ func runScan() {
 
 	// 2. Process and Filter Pairs
 	var momentumCandidates []TokenMomentumInfo
+	quoteMintsMap := make(map[string]bool)
+	for _, m := range strings.Split(commonQuoteMints, ",") {
+		quoteMintsMap[strings.TrimSpace(m)] = true
+	}
+	allowedLabels := parseLabelList(allowedPoolLabels)
+	deniedLabels := parseLabelList(deniedPoolLabels)
 	quoteSymbolsMap := make(map[string]bool)
-	for _, s := range strings.Split(commonQuoteSymbols, ",") {
-		quoteSymbolsMap[strings.TrimSpace(s)] = true
+	if matchQuoteSymbols {
+		for _, s := range strings.Split(commonQuoteSymbols, ",") {
+			quoteSymbolsMap[strings.TrimSpace(s)] = true
+		}
 	}
 
-
 	for _, pair := range pairs {
 		// Basic sanity checks
 		if pair.ChainID != solanaChainID {
@@ -198,15 +442,25 @@ func runScan() {
 			continue // Skip pairs with missing token info
 		}
 
-        // We are interested in the momentum of the BASE token typically when QUOTE is SOL/USDC/USDT
+		// We are interested in the momentum of the BASE token typically when QUOTE is SOL/USDC/USDT
 		// Or momentum of QUOTE token if BASE is SOL/USDC/USDT. Let's focus on the first case.
-		if !quoteSymbolsMap[pair.QuoteToken.Symbol] {
+		if !quoteMintsMap[pair.QuoteToken.Address] && !quoteSymbolsMap[pair.QuoteToken.Symbol] {
 			// If the quote token isn't one of our common ones, skip for simplicity for now.
-            // You could add logic here to handle pairs like XXX/YYY where neither is SOL/USDC.
+			// You could add logic here to handle pairs like XXX/YYY where neither is SOL/USDC.
 			continue
 		}
 
 		// Apply Filters
+		if !poolLabelsAccepted(pair.Labels, allowedLabels, deniedLabels) {
+			continue
+		}
+		if re := deniedSymbolPattern(pair.BaseToken); re != nil {
+			if !loggedSymbolDenials[pair.PairAddress] {
+				loggedSymbolDenials[pair.PairAddress] = true
+				log.Printf("🚷 Skipping %s (%s): matches deny pattern %q", pair.BaseToken.Symbol, pair.BaseToken.Name, re)
+			}
+			continue
+		}
 		if pair.Liquidity.Usd < minLiquidityUSD {
 			// log.Printf("DEBUG: Skip %s/%s - Low Liquidity: $%.2f", pair.BaseToken.Symbol, pair.QuoteToken.Symbol, pair.Liquidity.Usd)
 			continue
@@ -218,15 +472,16 @@ func runScan() {
 
 		// Add to our list
 		momentumCandidates = append(momentumCandidates, TokenMomentumInfo{
-			PairAddress:     pair.PairAddress,
-			BaseTokenSymbol: pair.BaseToken.Symbol,
-			BaseTokenAddr:   pair.BaseToken.Address,
-            QuoteTokenSymbol: pair.QuoteToken.Symbol,
-			PriceChangeM5:   pair.PriceChange.M5,
-			VolumeM5:        pair.Volume.M5,
-			LiquidityUSD:    pair.Liquidity.Usd,
-			PriceUSD:        pair.PriceUsd, // Keep as string, might be null/empty
-			PairURL:         pair.URL,
+			PairAddress:      pair.PairAddress,
+			BaseTokenSymbol:  pair.BaseToken.Symbol,
+			BaseTokenAddr:    pair.BaseToken.Address,
+			QuoteTokenSymbol: pair.QuoteToken.Symbol,
+			PriceChangeM5:    float64(pair.PriceChange.M5),
+			VolumeM5:         float64(pair.Volume.M5),
+			LiquidityUSD:     float64(pair.Liquidity.Usd),
+			PriceUSD:         string(pair.PriceUsd), // Keep as string, might be null/empty
+			PairURL:          pair.URL,
+			Labels:           pair.Labels,
 		})
 	}
 
@@ -238,10 +493,7 @@ func runScan() {
 	}
 
 	// 3. Sort candidates by 5-minute price change (descending)
-	sort.Slice(momentumCandidates, func(i, j int) bool {
-		// Handle NaN or Inf if necessary, though DexScreener data is usually clean
-		return momentumCandidates[i].PriceChangeM5 > momentumCandidates[j].PriceChangeM5
-	})
+	sortMovers(momentumCandidates)
 
 	// 4. Print the top N movers
 	log.Printf("📈 Top %d Movers (5min change, >$%.0f liquidity, >$%.0f 5m Vol):", topMoversCount, minLiquidityUSD, minVolume5mUSD)
@@ -250,15 +502,16 @@ func runScan() {
 		if count >= topMoversCount {
 			break
 		}
-		log.Printf("%2d. %-10s/%-4s | Change: %+.2f%% | Vol(5m): $%-8.0f | Liq: $%-10.0f | Price: %s | Pair: %s",
+		log.Printf("%2d. %-10s/%-4s | Change: %+.2f%% | Vol(5m): $%-8.0f | Liq: $%-10.0f | Price: %s | Pair: %s%s",
 			count+1,
 			token.BaseTokenSymbol,
-            token.QuoteTokenSymbol,
+			token.QuoteTokenSymbol,
 			token.PriceChangeM5,
 			token.VolumeM5,
 			token.LiquidityUSD,
 			token.PriceUSD,
 			token.PairAddress,
+			formatLabels(token.Labels),
 			// token.PairURL, // Optionally print the URL
 		)
 		count++
@@ -269,16 +522,39 @@ func runScan() {
 
 func main() {
 	log.SetOutput(os.Stdout) // Ensure logs go to standard out
+
+	flag.StringVar(&dexScreenerBaseURL, "dexscreener-url", envOrDefault("DEXSCREENER_URL", defaultDexScreenerBaseURL), "DexScreener API base URL, e.g. a caching proxy (env DEXSCREENER_URL)")
+	flag.Parse()
+	if _, err := dexScreenerURL(dexScreenerSearchPath, nil); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	denyRegexps, err := compileDenyPatterns(symbolDenyPatterns)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	symbolDenyRegexps = denyRegexps
+
 	log.Println("🚀 Starting DexScreener Momentum Scanner...")
 
+	// Ctrl+C / SIGTERM cancels an in-flight fetch and stops the loop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Run the scan immediately first time
-	runScan()
+	runScan(ctx)
 
 	// Then run in a loop
-	ticker := time.NewTicker(refreshInterval)
-	defer ticker.Stop() // Ensure ticker is stopped when main exits
-
-	for range ticker.C { // Block until the next tick
-		runScan()
+	timer := time.NewTimer(jitteredInterval(refreshInterval, pollJitterPercent))
+	defer timer.Stop() // Ensure timer is stopped when main exits
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 Shutting down.")
+			return
+		case <-timer.C: // Block until the next poll
+			timer.Reset(jitteredInterval(refreshInterval, pollJitterPercent)) // Re-arm first so scan time doesn't add to the interval
+			runScan(ctx)
+		}
 	}
-}
\ No newline at end of file
+}
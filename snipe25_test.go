@@ -0,0 +1,57 @@
+// snipe25_test.go
+//
+// Run with the file it tests, since every .go file here is its own program:
+//
+//	go test snipe25.go snipe25_test.go
+package main
+
+import (
+	"math/rand/v2"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestSortMoversBreaksTiesDeterministically(t *testing.T) {
+	want := []string{"TopGainer", "TieDeepPool", "TieA", "TieB", "TieC", "Laggard"}
+	movers := []TokenMomentumInfo{
+		{PairAddress: "TopGainer", PriceChangeM5: 12, LiquidityUSD: 10_000},
+		{PairAddress: "TieDeepPool", PriceChangeM5: 8, LiquidityUSD: 90_000},
+		{PairAddress: "TieA", PriceChangeM5: 8, LiquidityUSD: 50_000},
+		{PairAddress: "TieB", PriceChangeM5: 8, LiquidityUSD: 50_000},
+		{PairAddress: "TieC", PriceChangeM5: 8, LiquidityUSD: 50_000},
+		{PairAddress: "Laggard", PriceChangeM5: -3, LiquidityUSD: 200_000},
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 20 { // Whatever order the API sends them in
+		rng.Shuffle(len(movers), func(i, j int) { movers[i], movers[j] = movers[j], movers[i] })
+		sortMovers(movers)
+		var got []string
+		for _, m := range movers {
+			got = append(got, m.PairAddress)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("sorted %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRawDexScreenerPairsShapes(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		want    int
+	}{
+		{"testdata/dexscreener/search_pairs.json", 2},    // {"pairs": [...]}
+		{"testdata/dexscreener/pair_by_address.json", 1}, // {"pair": {...}}
+		{"testdata/dexscreener/token_pairs.json", 2},     // [...]
+	} {
+		body, err := os.ReadFile(c.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := rawDexScreenerPairs(body)
+		if err != nil || len(raw) != c.want {
+			t.Errorf("%s: %d pairs, %v, want %d", c.fixture, len(raw), err, c.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// snipe_test.go
+//
+// Run with the file it tests, since every .go file here is its own program:
+//
+//	go test snipe.go snipe_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// The Jupiter v6 /quote response for 0.1 SOL -> USDC, as the API returns it (including
+// fields JupiterQuote doesn't model, like platformFee)
+const jupiterQuoteFixture = "testdata/jupiter/quote_v6_sol_usdc.json"
+
+func TestJupiterQuoteDecodesV6Response(t *testing.T) {
+	data, err := os.ReadFile(jupiterQuoteFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q JupiterQuote
+	if err := json.Unmarshal(data, &q); err != nil {
+		t.Fatalf("decoding %s: %v", jupiterQuoteFixture, err)
+	}
+
+	if q.InputMint != wrappedSOLMint || q.InAmount != "100000000" || q.SwapMode != "ExactIn" || q.SlippageBps != 50 || q.ContextSlot != 299283763 {
+		t.Errorf("header fields: %+v", q)
+	}
+	if out, err := q.Out(); err != nil || out != 16198753 {
+		t.Errorf("Out() = %d, %v, want 16198753", out, err)
+	}
+	if minOut, err := q.MinOut(); err != nil || minOut != 16117760 {
+		t.Errorf("MinOut() = %d, %v, want 16117760", minOut, err)
+	}
+	if impact, err := q.PriceImpact(); err != nil || impact != 0 {
+		t.Errorf("PriceImpact() = %v, %v, want 0", impact, err)
+	}
+	if labels := q.RouteLabels(); !reflect.DeepEqual(labels, []string{"Meteora DLMM"}) {
+		t.Errorf("RouteLabels() = %v", labels)
+	}
+	step := q.RoutePlan[0]
+	if step.Percent != 100 || step.SwapInfo.FeeAmount != "24825" || step.SwapInfo.OutAmount != q.OutAmount {
+		t.Errorf("route step: %+v", step)
+	}
+	if err := checkPriceImpact(q); err != nil {
+		t.Errorf("checkPriceImpact: %v", err)
+	}
+}
+
+func TestJupiterQuoteRejectsUnusableFields(t *testing.T) {
+	q := JupiterQuote{OutAmount: "1.5e6", OtherAmountThreshold: "", PriceImpactPct: "n/a"}
+	if _, err := q.Out(); err == nil {
+		t.Error("Out() accepted a non-integer amount")
+	}
+	if _, err := q.MinOut(); err == nil {
+		t.Error("MinOut() accepted a missing threshold")
+	}
+	if err := checkPriceImpact(q); err == nil {
+		t.Error("checkPriceImpact accepted an unparseable priceImpactPct")
+	}
+	if err := checkPriceImpact(JupiterQuote{PriceImpactPct: "0.05"}); err == nil {
+		t.Errorf("checkPriceImpact accepted 5%% impact with a %.1f%% limit", maxPriceImpactPct)
+	}
+}
+
+func TestGetJSONRetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "upstream busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"outAmount":"42"}`))
+	}))
+	defer srv.Close()
+
+	var q JupiterQuote
+	if err := getJSON(srv.URL, &q); err != nil {
+		t.Fatalf("getJSON: %v", err)
+	}
+	if calls.Load() != 2 || q.OutAmount != "42" {
+		t.Errorf("%d calls, outAmount %q: want success on the 2nd call", calls.Load(), q.OutAmount)
+	}
+}
+
+func TestGetJSONDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	var q JupiterQuote
+	if err := getJSON(srv.URL, &q); err == nil {
+		t.Fatal("getJSON succeeded on a 404")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls for a 404, want 1", calls.Load())
+	}
+}
+
+// --- Preflight ---
+
+// Runs the check whose name starts with prefix; fails the test if there's none
+func runCheck(t *testing.T, prefix string) error {
+	t.Helper()
+	for _, c := range preflightChecks() {
+		if strings.HasPrefix(c.Name, prefix) {
+			_, err := c.Run()
+			return err
+		}
+	}
+	t.Fatalf("no %q check", prefix)
+	return nil
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// Sends every request httpClient makes, whatever its host, to a test server running h
+func stubJupiter(t *testing.T, h http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	configured := httpClient
+	httpClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	t.Cleanup(func() { httpClient = configured })
+}
+
+func TestPreflightFailures(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		check string
+		stub  func(t *testing.T, dir string)
+	}{
+		{"no wallet file", "Wallet file", func(*testing.T, string) {}},
+		{"wallet file not a key", "Wallet file", func(t *testing.T, _ string) {
+			if err := os.WriteFile("wallet.json", []byte(`"not-a-base58-key!"`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"working directory gone", "Write access", func(t *testing.T, dir string) {
+			if err := os.Remove(dir); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"Jupiter route not found", "Jupiter quote API", func(t *testing.T, _ string) {
+			stubJupiter(t, http.NotFound)
+		}},
+		{"Jupiter quote unusable", "Jupiter quote API", func(t *testing.T, _ string) {
+			stubJupiter(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"outAmount":""}`)) })
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			c.stub(t, dir)
+			if err := runCheck(t, c.check); err == nil {
+				t.Errorf("%s check passed", c.check)
+			}
+		})
+	}
+
+	t.Run("healthy", func(t *testing.T) { // The same checks pass without the stubs' faults
+		quote, err := os.ReadFile(jupiterQuoteFixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(t.TempDir())
+		if err := os.WriteFile("wallet.json", []byte(`"`+solana.NewWallet().PrivateKey.String()+`"`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		stubJupiter(t, func(w http.ResponseWriter, r *http.Request) { w.Write(quote) })
+		for _, check := range []string{"Wallet file", "Write access", "Jupiter quote API"} {
+			if err := runCheck(t, check); err != nil {
+				t.Errorf("%s check failed: %v", check, err)
+			}
+		}
+	})
+}